@@ -0,0 +1,247 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/botmanager"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+)
+
+// adminMaxBodySize limits the size of request bodies accepted by the admin endpoints.
+const adminMaxBodySize = 1024 * 1024
+
+// adminStatus is the response document of the admin status endpoint.
+type adminStatus struct {
+	Name               string             `json:"name"`
+	Enabled            bool               `json:"enabled"`
+	BotAction          string             `json:"botAction"`
+	BotBlockHTTPCode   int                `json:"botBlockHttpCode"`
+	SetNoArchiveHeader bool               `json:"setNoArchiveHeader"`
+	ShadowMode         bool               `json:"shadowMode"`
+	ShadowLiveAction   string             `json:"shadowLiveAction,omitempty"`
+	ShadowDecisions    map[string]int     `json:"shadowDecisions,omitempty"`
+	Status             botmanager.Status  `json:"status"`
+	Profiles           []adminProfileInfo `json:"profiles,omitempty"`
+}
+
+// adminProfileInfo describes the configuration and state of a host profile.
+type adminProfileInfo struct {
+	Hosts     []string          `json:"hosts"`
+	BotAction string            `json:"botAction"`
+	Status    botmanager.Status `json:"status"`
+}
+
+// adminRefreshResult is the response document of the admin refresh endpoint.
+// The diff holds the changes made even if the refresh failed, as sources that could be retrieved are still applied.
+type adminRefreshResult struct {
+	Diff     botmanager.Diff      `json:"diff"`
+	Error    string               `json:"error,omitempty"`
+	Profiles []adminProfileResult `json:"profiles,omitempty"`
+}
+
+// adminProfileResult describes the outcome of refreshing a host profile.
+type adminProfileResult struct {
+	Hosts []string        `json:"hosts"`
+	Diff  botmanager.Diff `json:"diff"`
+	Error string          `json:"error,omitempty"`
+}
+
+// adminTestRequest is the request document of the admin test endpoint. The path, method, host and IP describe the request to evaluate the User-Agents against.
+type adminTestRequest struct {
+	UserAgents []string `json:"userAgents"`
+	Path       string   `json:"path"`
+	Method     string   `json:"method"`
+	Host       string   `json:"host"`
+	IP         string   `json:"ip"`
+}
+
+// adminTestResult describes how a User-Agent would be handled by the plugin.
+type adminTestResult struct {
+	UserAgent   string   `json:"userAgent"`
+	BotName     string   `json:"botName,omitempty"`
+	Offsets     [][2]int `json:"offsets,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Operator    string   `json:"operator,omitempty"`
+	InScope     bool     `json:"inScope"`
+	Action      string   `json:"action"`
+	WouldAction string   `json:"wouldAction,omitempty"`
+}
+
+// initAdmin sets up the admin endpoints, if an admin path is configured.
+func (w *Wrangler) initAdmin(c *config.Config) {
+	if c.AdminPath == "" {
+		return
+	}
+	w.adminPath = c.AdminPath
+	w.adminToken = c.AdminToken
+	// we validated the allowlist earlier, so ignore any error now
+	w.adminAllowIPs, _ = config.ParseIPNets(c.AdminAllowIPs)
+}
+
+// isAdminRequest checks if the request is for one of the admin endpoints.
+func (w *Wrangler) isAdminRequest(req *http.Request) bool {
+	return w.adminPath != "" && strings.HasPrefix(req.URL.Path, w.adminPath+"/")
+}
+
+// adminAuthorized checks if the request carries the admin bearer token, or originates from an allowed IP address.
+// The address of the connection is used rather than any forwarded headers, since those can be set by the client.
+func (w *Wrangler) adminAuthorized(req *http.Request) bool {
+	if w.adminToken != "" {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(w.adminToken)) == 1 {
+			return true
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range w.adminAllowIPs {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveAdmin routes a request to the matching admin endpoint.
+func (w *Wrangler) serveAdmin(rw http.ResponseWriter, req *http.Request) {
+	if !w.adminAuthorized(req) {
+		w.log.Warn("ServeHTTP: Unauthorized admin request", "sourceIP", req.RemoteAddr, "requestedPath", req.URL.Path)
+		writeAdminJSON(rw, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return
+	}
+	endpoint := strings.TrimPrefix(req.URL.Path, w.adminPath)
+	method, ok := map[string]string{"/status": http.MethodGet, "/refresh": http.MethodPost, "/test": http.MethodPost}[endpoint]
+	if !ok {
+		writeAdminJSON(rw, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if req.Method != method {
+		rw.Header().Set("Allow", method)
+		writeAdminJSON(rw, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	switch endpoint {
+	case "/status":
+		writeAdminJSON(rw, http.StatusOK, w.adminStatus())
+	case "/refresh":
+		w.serveAdminRefresh(rw)
+	case "/test":
+		w.serveAdminTest(rw, req)
+	}
+}
+
+// serveAdminRefresh forces an update of the bot index of each BotUAManager, responding with the changes made.
+// The shared sources of every BotUAManager are invalidated up front, so each is retrieved once rather than once per profile.
+// A failure of one BotUAManager doesn't stop the others being refreshed, and is reported alongside the changes that were made.
+func (w *Wrangler) serveAdminRefresh(rw http.ResponseWriter) {
+	w.botUAManager.InvalidateSources()
+	for _, p := range w.profiles {
+		p.botUAManager.InvalidateSources()
+	}
+
+	code := http.StatusOK
+	var res adminRefreshResult
+	var err error
+	res.Diff, err = w.botUAManager.RefreshPooled()
+	if err != nil {
+		code = http.StatusBadGateway
+		res.Error = err.Error()
+	}
+	for _, p := range w.profiles {
+		pRes := adminProfileResult{Hosts: p.hosts}
+		pRes.Diff, err = p.botUAManager.RefreshPooled()
+		if err != nil {
+			code = http.StatusBadGateway
+			pRes.Error = err.Error()
+		}
+		res.Profiles = append(res.Profiles, pRes)
+	}
+	writeAdminJSON(rw, code, res)
+}
+
+// serveAdminTest evaluates each provided User-Agent against the bot index, responding with the match and the action that would be taken.
+// Nothing is logged, audited, or cached for the evaluated User-Agents, nor do they count as requests towards a bot's crawl-delay.
+func (w *Wrangler) serveAdminTest(rw http.ResponseWriter, req *http.Request) {
+	var t adminTestRequest
+	err := json.NewDecoder(http.MaxBytesReader(rw, req.Body, adminMaxBodySize)).Decode(&t)
+	if err != nil || len(t.UserAgents) == 0 {
+		writeAdminJSON(rw, http.StatusBadRequest, map[string]string{"error": "body must be a JSON object with a non-empty 'userAgents' list"})
+		return
+	}
+	if t.Path == "" {
+		t.Path = "/"
+	}
+	if t.Method == "" {
+		t.Method = http.MethodGet
+	}
+	if t.Host == "" {
+		t.Host = req.Host
+	}
+	tReq := &http.Request{Method: strings.ToUpper(t.Method), Host: t.Host, URL: &url.URL{Path: t.Path}, RemoteAddr: t.IP, Header: http.Header{}}
+	botAction, wouldAction, uAMan, inScope := w.requestAction(tReq)
+
+	results := make([]adminTestResult, 0, len(t.UserAgents))
+	for _, uA := range t.UserAgents {
+		res := adminTestResult{UserAgent: uA, InScope: inScope, Action: config.BotActionPass}
+		m, err := uAMan.Explain(uA)
+		if err != nil {
+			writeAdminJSON(rw, http.StatusBadGateway, map[string]string{"error": err.Error()})
+			return
+		}
+		res.BotName, res.Offsets, res.Source, res.Operator = m.BotName, m.Offsets, m.Info.Source, m.Info.JSONMetadata.Operator
+		uAWouldAction := wouldAction
+		switch {
+		case !inScope:
+		case m.BotName != "":
+			res.Action, uAWouldAction = w.peekCrawlDelay(tReq, botAction, wouldAction, m.BotName, m.Info)
+		case wouldAction == config.BotActionMaze && w.maze.Contains(t.Path) && botAction == config.BotActionMaze:
+			// unlisted visitors inside the maze keep getting maze pages
+			res.Action = botAction
+		}
+		if w.shadowMode && inScope {
+			res.WouldAction = uAWouldAction
+		}
+		results = append(results, res)
+	}
+	writeAdminJSON(rw, http.StatusOK, map[string][]adminTestResult{"results": results})
+}
+
+// adminStatus collects the current action configuration, along with the state of the index, sources, and cache of each BotUAManager.
+func (w *Wrangler) adminStatus() adminStatus {
+	s := adminStatus{
+		Name:               w.name,
+		Enabled:            w.enabled,
+		BotAction:          w.botAction,
+		BotBlockHTTPCode:   w.botBlockHTTPCode,
+		SetNoArchiveHeader: w.setNoArchiveHeader,
+		ShadowMode:         w.shadowMode,
+		Status:             w.botUAManager.Status(),
+	}
+	if w.shadowMode {
+		s.ShadowLiveAction = w.shadowLiveAction
+		s.ShadowDecisions = w.decisions.snapshot()
+	}
+	for _, p := range w.profiles {
+		s.Profiles = append(s.Profiles, adminProfileInfo{Hosts: p.hosts, BotAction: p.botAction, Status: p.botUAManager.Status()})
+	}
+	return s
+}
+
+// writeAdminJSON writes the provided value as the JSON body of an admin response.
+func writeAdminJSON(rw http.ResponseWriter, code int, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(code)
+	_ = json.NewEncoder(rw).Encode(v)
+}
@@ -0,0 +1,308 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/botmanager"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+)
+
+func getAdminWrangler(t *testing.T, token string, allowIPs string) *Wrangler {
+	t.Helper()
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL
+	cfg.AdminPath = "/.wrangler"
+	cfg.AdminToken = token
+	cfg.AdminAllowIPs = allowIPs
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	h, err := New(ctx, http.NotFoundHandler(), cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := h.(*Wrangler)
+	if !ok {
+		t.Fatal("unable to assert handler as type Wrangler")
+	}
+	return w
+}
+
+// TestWranglerAdminStatus tests that the admin status endpoint reports the index, sources, and cache when authorized
+func TestWranglerAdminStatus(t *testing.T) {
+	w := getAdminWrangler(t, "secret", "")
+	_ = getWranglerResponse(t, w, "http://localhost/page", BotUserAgent)
+	_ = getWranglerResponse(t, w, "http://localhost/page", BotUserAgent)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/.wrangler/status", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var s adminStatus
+	err := json.NewDecoder(rec.Body).Decode(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "wrangler" || s.BotAction != "LOG" {
+		t.Errorf("status did not describe the action configuration. Got %+v", s)
+	}
+	if s.Status.IndexSize != 1 || len(s.Status.Sources) != 1 || s.Status.Sources[0].Bots != 1 || s.Status.Sources[0].LastSuccess.IsZero() {
+		t.Errorf("status did not describe the index and its source. Got %+v", s.Status)
+	}
+	if s.Status.Cache.Hits != 1 || s.Status.Cache.Misses != 1 || s.Status.Cache.Size != 1 {
+		t.Errorf("expected one cache hit and one miss, got %+v", s.Status.Cache)
+	}
+	if s.Status.NextUpdate.IsZero() {
+		t.Error("expected nextUpdate to be set")
+	}
+}
+
+// TestWranglerAdminAuth tests that the admin endpoints require the bearer token or an allowed client IP
+func TestWranglerAdminAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		allowIPs   string
+		header     string
+		remoteAddr string
+		want       int
+	}{
+		{name: "NoCredentials", token: "secret", remoteAddr: "192.0.2.1:1234", want: http.StatusUnauthorized},
+		{name: "WrongToken", token: "secret", header: "Bearer nope", remoteAddr: "192.0.2.1:1234", want: http.StatusUnauthorized},
+		{name: "Token", token: "secret", header: "Bearer secret", remoteAddr: "192.0.2.1:1234", want: http.StatusOK},
+		{name: "AllowedIP", allowIPs: "10.0.0.0/8, 192.0.2.1", remoteAddr: "192.0.2.1:1234", want: http.StatusOK},
+		{name: "AllowedCIDR", allowIPs: "10.0.0.0/8", remoteAddr: "10.1.2.3:1234", want: http.StatusOK},
+		{name: "DisallowedIP", allowIPs: "10.0.0.0/8", remoteAddr: "192.0.2.1:1234", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := getAdminWrangler(t, tt.token, tt.allowIPs)
+			req := httptest.NewRequest(http.MethodGet, "http://localhost/.wrangler/status", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			w.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
+
+// TestWranglerAdminRefresh tests that a forced refresh retrieves the source again, and reports the bots added and removed
+func TestWranglerAdminRefresh(t *testing.T) {
+	var lock sync.Mutex
+	entry := `{"operator": "Op", "respect": "No", "function": "Fn", "frequency": "Freq", "description": "Desc"}`
+	body := `{"GPTBot": ` + entry + `}`
+	src := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		rw.Header().Set("Content-Type", "application/json")
+		_, _ = rw.Write([]byte(body))
+	}))
+	defer src.Close()
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL
+	cfg.AdminPath = "/.wrangler"
+	cfg.AdminToken = "secret"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := New(ctx, http.NotFoundHandler(), cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	body = `{"ClaudeBot": ` + entry + `}`
+	lock.Unlock()
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/.wrangler/refresh", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var res adminRefreshResult
+	err = json.NewDecoder(rec.Body).Decode(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(botmanager.Names(res.Diff.Added), []string{"ClaudeBot"}) || !slices.Equal(botmanager.Names(res.Diff.Removed), []string{"GPTBot"}) {
+		t.Errorf("expected ClaudeBot added and GPTBot removed, got %+v", res.Diff)
+	}
+}
+
+// TestWranglerAdminRefreshProfiles tests that a source shared between profiles is retrieved once per refresh,
+// and that a profile failing to refresh is reported alongside the changes made to the others
+func TestWranglerAdminRefreshProfiles(t *testing.T) {
+	var lock sync.Mutex
+	requests := map[string]int{}
+	failing := false
+	src := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests[r.URL.Path]++
+		switch {
+		case r.URL.Path == "/ClaudeBot" && failing:
+			rw.WriteHeader(http.StatusInternalServerError)
+		case r.URL.Path == "/GPTBot" && failing:
+			_, _ = rw.Write([]byte("User-agent: GPTBot\nUser-agent: NewBot\nDisallow: /\n"))
+		default:
+			_, _ = rw.Write([]byte("User-agent: " + strings.TrimPrefix(r.URL.Path, "/") + "\nDisallow: /\n"))
+		}
+	}))
+	defer src.Close()
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL + "/GPTBot"
+	cfg.Profiles = []config.Profile{
+		{Hosts: "shop.example.com", BotAction: config.BotActionBlock},
+		{Hosts: "blog.example.com", RobotsSourceURL: src.URL + "/ClaudeBot"},
+	}
+	cfg.AdminPath = "/.wrangler"
+	cfg.AdminToken = "secret"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := New(ctx, http.NotFoundHandler(), cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	failing = true
+	requests = map[string]int{}
+	lock.Unlock()
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/.wrangler/refresh", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("expected status 502 when a profile fails to refresh, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var res adminRefreshResult
+	err = json.NewDecoder(rec.Body).Decode(&res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Error != "" || !slices.Equal(botmanager.Names(res.Diff.Added), []string{"NewBot"}) {
+		t.Errorf("expected the top level refresh to succeed and add NewBot, got %+v", res)
+	}
+	if len(res.Profiles) != 2 {
+		t.Fatalf("expected a result for each profile, got %+v", res.Profiles)
+	}
+	if res.Profiles[0].Error != "" || !slices.Equal(botmanager.Names(res.Profiles[0].Diff.Added), []string{"NewBot"}) {
+		t.Errorf("expected the profile sharing the source to add NewBot, got %+v", res.Profiles[0])
+	}
+	if res.Profiles[1].Error == "" {
+		t.Errorf("expected the profile with the failing source to report its error, got %+v", res.Profiles[1])
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if requests["/GPTBot"] != 1 || requests["/ClaudeBot"] != 1 {
+		t.Errorf("expected each source to be retrieved once per refresh, regardless of how many profiles use it. Got %v", requests)
+	}
+}
+
+// TestWranglerAdminTest tests that the admin test endpoint reports the match and action for each User-Agent, respecting scopes
+func TestWranglerAdminTest(t *testing.T) {
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL
+	cfg.BotAction = "BLOCK"
+	cfg.ExcludePaths = "/health"
+	cfg.AdminPath = "/.wrangler"
+	cfg.AdminAllowIPs = "192.0.2.1"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := New(ctx, http.NotFoundHandler(), cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		want   []adminTestResult
+		status int
+	}{
+		{
+			name:   "Match",
+			body:   `{"userAgents": ["` + BotUserAgent + `", "` + RealUserAgent + `"], "path": "/page"}`,
+			status: http.StatusOK,
+			want: []adminTestResult{
+				{UserAgent: BotUserAgent, BotName: "GPTBot", Offsets: [][2]int{{strings.Index(BotUserAgent, "GPTBot"), strings.Index(BotUserAgent, "GPTBot") + len("GPTBot")}}, Source: src.URL, Operator: "OpenAI", InScope: true, Action: "BLOCK"},
+				{UserAgent: RealUserAgent, InScope: true, Action: "PASS"},
+			},
+		},
+		{
+			name:   "OutOfScope",
+			body:   `{"userAgents": ["` + BotUserAgent + `"], "path": "/health", "ip": "198.51.100.1"}`,
+			status: http.StatusOK,
+			want: []adminTestResult{
+				{UserAgent: BotUserAgent, BotName: "GPTBot", Offsets: [][2]int{{strings.Index(BotUserAgent, "GPTBot"), strings.Index(BotUserAgent, "GPTBot") + len("GPTBot")}}, Source: src.URL, Operator: "OpenAI", Action: "PASS"},
+			},
+		},
+		{name: "Empty", body: `{"userAgents": []}`, status: http.StatusBadRequest},
+		{name: "Malformed", body: `userAgents`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://localhost/.wrangler/test", strings.NewReader(tt.body))
+			req.RemoteAddr = "192.0.2.1:1234"
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if tt.want == nil {
+				return
+			}
+			var res map[string][]adminTestResult
+			err := json.NewDecoder(rec.Body).Decode(&res)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(res["results"], tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, res["results"])
+			}
+		})
+	}
+}
+
+// TestWranglerAdminMethod tests that the admin endpoints reject unexpected methods and paths
+func TestWranglerAdminMethod(t *testing.T) {
+	w := getAdminWrangler(t, "secret", "")
+	tests := map[string]struct {
+		method string
+		path   string
+		want   int
+	}{
+		"StatusPost": {method: http.MethodPost, path: "/.wrangler/status", want: http.StatusMethodNotAllowed},
+		"RefreshGet": {method: http.MethodGet, path: "/.wrangler/refresh", want: http.StatusMethodNotAllowed},
+		"Unknown":    {method: http.MethodGet, path: "/.wrangler/nope", want: http.StatusNotFound},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://localhost"+tt.path, nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			rec := httptest.NewRecorder()
+			w.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
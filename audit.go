@@ -0,0 +1,81 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/audit"
+)
+
+// statusRecorder wraps a ResponseWriter to capture the status and size of the response sent.
+type statusRecorder struct {
+	http.ResponseWriter
+	bytes  int64
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying ResponseWriter, used when proxying.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// clientIP resolves the IP address of the client that made the request.
+// Traefik sets X-Real-Ip from the connection (or trusted forwarded headers), so it is preferred over the address of the connection to us.
+func clientIP(req *http.Request) string {
+	if ip := req.Header.Get("X-Real-Ip"); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// auditResponse applies the handler to the request, writing a record of it to the audit log if one is configured.
+func (w *Wrangler) auditResponse(rw http.ResponseWriter, req *http.Request, botName string, source string, botAction string, h func(http.ResponseWriter)) {
+	if w.audit == nil {
+		h(rw)
+		return
+	}
+	rec := &statusRecorder{ResponseWriter: rw}
+	h(rec)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	err := w.audit.Write(audit.Record{
+		Time:      time.Now(),
+		ClientIP:  clientIP(req),
+		Method:    req.Method,
+		Host:      req.Host,
+		Path:      req.URL.RequestURI(),
+		Protocol:  req.Proto,
+		Referer:   req.Referer(),
+		UserAgent: req.Header.Get("User-Agent"),
+		BotName:   botName,
+		Source:    source,
+		Action:    botAction,
+		Status:    rec.status,
+		Bytes:     rec.bytes,
+	})
+	if err != nil {
+		w.log.Error("ServeHTTP: unable to write audit record. " + err.Error())
+	}
+}
@@ -0,0 +1,96 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/audit"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/logger"
+)
+
+// TestWranglerAuditLog tests that a record is written to the audit log for each remediated request, and not for other traffic
+func TestWranglerAuditLog(t *testing.T) {
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.BotAction = config.BotActionBlock
+	cfg.RobotsSourceURL = src.URL
+	cfg.AuditLogPath = t.TempDir() + "/audit.log"
+	h, err := New(context.Background(), http.NotFoundHandler(), cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := h.(*Wrangler)
+	if !ok {
+		t.Fatal("unable to assert handler as type Wrangler")
+	}
+
+	_ = getWranglerResponse(t, w, "http://localhost/page", BotUserAgent)
+	_ = getWranglerResponse(t, w, "http://localhost/page", RealUserAgent)
+
+	out, err := os.ReadFile(cfg.AuditLogPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one audit record for the single remediated request, got %d: %s", len(lines), out)
+	}
+	var r audit.Record
+	err = json.Unmarshal([]byte(lines[0]), &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.BotName != "GPTBot" || r.Source != src.URL || r.Action != config.BotActionBlock || r.Status != cfg.BotBlockHTTPCode || r.Bytes == 0 || r.Path != "/page" {
+		t.Errorf("audit record did not describe the remediated request. Got %+v", r)
+	}
+}
+
+// TestWranglerAuditLogClosed tests that the audit log is closed once the plugin's context is canceled, so reloads don't leak it
+func TestWranglerAuditLogClosed(t *testing.T) {
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.BotAction = config.BotActionBlock
+	cfg.RobotsSourceURL = src.URL
+	cfg.AuditLogPath = t.TempDir() + "/audit.log"
+	ctx, cancel := context.WithCancel(context.Background())
+	h, err := New(ctx, http.NotFoundHandler(), cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := h.(*Wrangler)
+	if !ok {
+		t.Fatal("unable to assert handler as type Wrangler")
+	}
+	var out strings.Builder
+	w.log = logger.NewFromWriter(config.LogLevelInfo, &out)
+	cancel()
+
+	// the file is closed in the background, so wait for writes to start failing
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(out.String(), "unable to write audit record") {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the audit log to be closed once the context was canceled")
+		}
+		_ = getWranglerResponse(t, w, "http://localhost/page", BotUserAgent)
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestClientIP tests that the client IP is taken from X-Real-Ip when Traefik provides it, falling back to the connection's address
+func TestClientIP(t *testing.T) {
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://localhost/", nil)
+	req.RemoteAddr = "192.0.2.1:54321"
+	if ip := clientIP(req); ip != "192.0.2.1" {
+		t.Errorf("expected client IP from the remote address, got '%s'", ip)
+	}
+	req.Header.Set("X-Real-Ip", "198.51.100.7")
+	if ip := clientIP(req); ip != "198.51.100.7" {
+		t.Errorf("expected client IP from X-Real-Ip, got '%s'", ip)
+	}
+}
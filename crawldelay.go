@@ -0,0 +1,81 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/parser"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/throttle"
+)
+
+const (
+	// botActionThrottle is applied to bots requesting faster than their crawl-delay. It isn't configurable as a botAction.
+	botActionThrottle = "THROTTLE"
+	// crawlDelayExpireInterval is how often bots that may make another request are forgotten.
+	crawlDelayExpireInterval = time.Minute
+)
+
+// initCrawlDelay sets up tracking of the requests made by each bot and client IP, if crawl-delays are enforced.
+func (w *Wrangler) initCrawlDelay(ctx context.Context, c *config.Config) {
+	if !c.CrawlDelayEnforce {
+		return
+	}
+	w.crawlDelays = throttle.New()
+	go w.expireCrawlDelays(ctx)
+}
+
+// expireCrawlDelays periodically forgets bots that may make another request, until the context is canceled.
+func (w *Wrangler) expireCrawlDelays(ctx context.Context) {
+	t := time.NewTicker(crawlDelayExpireInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			w.crawlDelays.Expire(now)
+		}
+	}
+}
+
+// applyCrawlDelay changes the action for a bot that would be let through to THROTTLE, if it's requesting faster than its crawl-delay.
+// In shadow mode, only the action that would be taken is changed.
+func (w *Wrangler) applyCrawlDelay(req *http.Request, botAction string, wouldAction string, botName string, botInfo parser.BotUserAgent) (string, string) {
+	if !w.crawlDelayApplies(wouldAction, botInfo) || w.crawlDelays.Allow(botName, clientIP(req), botInfo.CrawlDelay, time.Now()) {
+		return botAction, wouldAction
+	}
+	return w.throttleAction(botAction)
+}
+
+// peekCrawlDelay is applyCrawlDelay without recording the request, for evaluating one without holding up the bot's next request.
+func (w *Wrangler) peekCrawlDelay(req *http.Request, botAction string, wouldAction string, botName string, botInfo parser.BotUserAgent) (string, string) {
+	if !w.crawlDelayApplies(wouldAction, botInfo) || w.crawlDelays.Wait(botName, clientIP(req), time.Now()) == 0 {
+		return botAction, wouldAction
+	}
+	return w.throttleAction(botAction)
+}
+
+// crawlDelayApplies checks if crawl-delays are enforced, and the bot has one and would be let through.
+func (w *Wrangler) crawlDelayApplies(wouldAction string, botInfo parser.BotUserAgent) bool {
+	return w.crawlDelays != nil && botInfo.CrawlDelay > 0 && (wouldAction == config.BotActionPass || wouldAction == config.BotActionLog)
+}
+
+// throttleAction returns the actions to take for a bot requesting faster than its crawl-delay.
+func (w *Wrangler) throttleAction(botAction string) (string, string) {
+	if w.shadowMode {
+		return botAction, botActionThrottle
+	}
+	return botActionThrottle, botActionThrottle
+}
+
+// handleOutcomeThrottle processes tasks if the bot is requesting faster than its crawl-delay, telling it when it may try again.
+func (w *Wrangler) handleOutcomeThrottle(rw http.ResponseWriter, req *http.Request, botName string) {
+	wait := w.crawlDelays.Wait(botName, clientIP(req), time.Now())
+	// Retry-After is in whole seconds, so round up rather than invite a retry that's still too soon
+	rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	rw.WriteHeader(http.StatusTooManyRequests)
+}
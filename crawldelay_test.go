@@ -0,0 +1,136 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/logger"
+)
+
+// getCrawlDelayWrangler returns a plugin instance enforcing the crawl-delay of a robots.txt source, which asks GPTBot to wait 30s between requests.
+func getCrawlDelayWrangler(t *testing.T, botAction string, shadow bool) *Wrangler {
+	t.Helper()
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, "User-agent: GPTBot\nCrawl-delay: 30\nDisallow: /private\n\nUser-agent: ClaudeBot\nDisallow: /private\n")
+	}))
+	t.Cleanup(src.Close)
+	cfg := CreateConfig()
+	cfg.BotAction = botAction
+	cfg.RobotsSourceURL = src.URL
+	cfg.CrawlDelayEnforce = true
+	cfg.ShadowMode = shadow
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, "upstream")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	h, err := New(ctx, next, cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := h.(*Wrangler)
+	if !ok {
+		t.Fatal("unable to assert handler as type Wrangler")
+	}
+	return w
+}
+
+// TestWranglerCrawlDelay tests that a bot requesting faster than its crawl-delay gets a 429 with Retry-After, per client IP
+func TestWranglerCrawlDelay(t *testing.T) {
+	w := getCrawlDelayWrangler(t, config.BotActionPass, false)
+	bot := "Mozilla/5.0 (compatible; GPTBot/1.2)"
+
+	res := getWranglerResponse(t, w, "http://localhost/", bot)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the first request to pass, got %d", res.StatusCode)
+	}
+	res = getWranglerResponse(t, w, "http://localhost/", bot)
+	if res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected a request within the crawl-delay to get %d, got %d", http.StatusTooManyRequests, res.StatusCode)
+	}
+	if got := res.Header.Get("Retry-After"); got != "30" {
+		t.Errorf("expected Retry-After of 30, got '%s'", got)
+	}
+
+	// another client IP, and a bot without a crawl-delay, aren't held up
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+	req.Header.Set("User-Agent", bot)
+	req.Header.Set("X-Real-Ip", "198.51.100.7")
+	w.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Errorf("expected a request from another client IP to pass, got %d", rw.Code)
+	}
+	for i := 0; i < 2; i++ { //nolint:intrange,modernize
+		res = getWranglerResponse(t, w, "http://localhost/", "ClaudeBot/1.0")
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("expected a bot without a crawl-delay to pass, got %d", res.StatusCode)
+		}
+	}
+}
+
+// TestWranglerCrawlDelayActions tests that the crawl-delay is only enforced on bots that would otherwise be let through, and only logged in shadow mode
+func TestWranglerCrawlDelayActions(t *testing.T) {
+	tests := []struct {
+		name      string
+		botAction string
+		shadow    bool
+		want      int
+		wantLog   string
+	}{
+		{name: "Log", botAction: config.BotActionLog, want: http.StatusTooManyRequests, wantLog: "remediationAction=THROTTLE"},
+		{name: "Block", botAction: config.BotActionBlock, want: http.StatusForbidden},
+		{name: "Shadow", botAction: config.BotActionPass, shadow: true, want: http.StatusOK, wantLog: "wouldAction=THROTTLE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := getCrawlDelayWrangler(t, tt.botAction, tt.shadow)
+			var out strings.Builder
+			w.log = logger.NewFromWriter(config.LogLevelInfo, &out)
+
+			_ = getWranglerResponse(t, w, "http://localhost/", "GPTBot")
+			res := getWranglerResponse(t, w, "http://localhost/", "GPTBot")
+			if res.StatusCode != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, res.StatusCode)
+			}
+			if !strings.Contains(out.String(), tt.wantLog) {
+				t.Errorf("expected log to contain '%s'. Got: %s", tt.wantLog, out.String())
+			}
+		})
+	}
+}
+
+// TestWranglerAdminTestCrawlDelay tests that the admin test endpoint reports THROTTLE for a bot and client IP within the crawl-delay, without counting as a request
+func TestWranglerAdminTestCrawlDelay(t *testing.T) {
+	w := getCrawlDelayWrangler(t, config.BotActionPass, false)
+	bot := "Mozilla/5.0 (compatible; GPTBot/1.2)"
+	serve := func(ip string) int {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://localhost/", nil)
+		req.Header.Set("User-Agent", bot)
+		req.Header.Set("X-Real-Ip", ip)
+		w.ServeHTTP(rw, req)
+		return rw.Code
+	}
+	_ = serve("192.0.2.1")
+
+	for ip, want := range map[string]string{"192.0.2.1": botActionThrottle, "198.51.100.7": config.BotActionPass} {
+		// evaluating twice checks that the first evaluation didn't hold up the next
+		for i := 0; i < 2; i++ { //nolint:intrange,modernize
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "http://localhost/.wrangler/test", strings.NewReader(`{"userAgents": ["`+bot+`"], "ip": "`+ip+`"}`))
+			w.serveAdminTest(rw, req)
+			if !strings.Contains(rw.Body.String(), `"action":"`+want+`"`) {
+				t.Errorf("expected action %s for client IP %s, got %s", want, ip, rw.Body.String())
+			}
+		}
+	}
+	if code := serve("198.51.100.7"); code != http.StatusOK {
+		t.Errorf("expected a request after evaluating the same client IP to pass, got %d", code)
+	}
+}
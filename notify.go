@@ -0,0 +1,65 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/botmanager"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/notify"
+)
+
+// initNotify sets up delivery of detection, source refresh, and index change events to the configured webhooks.
+func (w *Wrangler) initNotify(ctx context.Context, c *config.Config) {
+	if c.NotifyWebhookURLs == "" {
+		return
+	}
+	w.notifier = notify.New(ctx, c, w.log, w.name)
+	// we validated the time duration earlier, so ignore any error now
+	window, _ := time.ParseDuration(c.NotifyThresholdWindow)
+	w.detector = notify.NewDetector(c.NotifyThreshold, window)
+	for _, m := range w.botManagers() {
+		m.OnRefresh(func(err error) {
+			if err != nil {
+				w.notifier.Notify(notify.Event{Type: notify.EventRefreshFailed, Error: err.Error()})
+			}
+		})
+		m.OnChange(func(d botmanager.Diff) {
+			for src, sd := range d.BySource() {
+				w.notifier.Notify(notify.Event{
+					Type:    notify.EventIndexChanged,
+					Source:  src,
+					Added:   botmanager.Names(sd.Added),
+					Removed: botmanager.Names(sd.Removed),
+					Changed: botmanager.Names(sd.Changed),
+				})
+			}
+		})
+	}
+}
+
+// notifyDetection records a request from a bot, notifying webhooks if it is the bot's first sighting or crosses the hit threshold.
+func (w *Wrangler) notifyDetection(req *http.Request, botName string) {
+	if w.notifier == nil {
+		return
+	}
+	first, count := w.detector.Observe(botName, time.Now())
+	e := notify.Event{
+		BotName:   botName,
+		UserAgent: req.Header.Get("User-Agent"),
+		ClientIP:  clientIP(req),
+		Host:      req.Host,
+		Path:      req.URL.Path,
+	}
+	if first {
+		e.Type = notify.EventNewBot
+		w.notifier.Notify(e)
+	}
+	if count > 0 {
+		e.Type = notify.EventThreshold
+		e.Count = count
+		e.Window = w.detector.Window().String()
+		w.notifier.Notify(e)
+	}
+}
@@ -0,0 +1,58 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/notify"
+)
+
+// TestWranglerNotify tests that webhooks are notified of the first sighting of a bot, and when it crosses the hit threshold
+func TestWranglerNotify(t *testing.T) {
+	events := make(chan notify.Event, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var e notify.Event
+		_ = json.NewDecoder(r.Body).Decode(&e)
+		events <- e
+	}))
+	defer hook.Close()
+
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL
+	cfg.NotifyWebhookURLs = hook.URL
+	cfg.NotifyThreshold = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := New(ctx, http.NotFoundHandler(), cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := h.(*Wrangler)
+	if !ok {
+		t.Fatal("unable to assert handler as type Wrangler")
+	}
+
+	for i := 0; i < 3; i++ { //nolint:intrange,modernize
+		_ = getWranglerResponse(t, w, "http://localhost/page", BotUserAgent)
+	}
+	var got []string
+	for len(got) < 2 {
+		select {
+		case e := <-events:
+			if e.BotName != "GPTBot" || e.Middleware != "wrangler" {
+				t.Errorf("event did not describe the detected bot. Got %+v", e)
+			}
+			got = append(got, e.Type)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected new bot and threshold events, got %v", got)
+		}
+	}
+	if got[0] != notify.EventNewBot || got[1] != notify.EventThreshold {
+		t.Errorf("expected new bot then threshold events, got %v", got)
+	}
+}
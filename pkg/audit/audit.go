@@ -0,0 +1,85 @@
+// Package audit provides the Logger type, which writes a record of each remediated bot request to a dedicated stream.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// supported audit log formats.
+const (
+	FormatNDJSON   = "NDJSON"
+	FormatCombined = "COMBINED"
+)
+
+// Record describes a single remediated request.
+type Record struct {
+	Time      time.Time `json:"time"`
+	ClientIP  string    `json:"clientIp"`
+	Method    string    `json:"method"`
+	Host      string    `json:"host"`
+	Path      string    `json:"path"`
+	Protocol  string    `json:"protocol"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"userAgent"`
+	BotName   string    `json:"botName"`
+	Source    string    `json:"source"`
+	Action    string    `json:"action"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+}
+
+// Logger writes audit records in a single format.
+type Logger struct {
+	format string
+	lock   sync.Mutex
+	w      io.Writer
+}
+
+// New initializes a Logger writing records in the provided format, either NDJSON or COMBINED, to w.
+func New(w io.Writer, format string) *Logger {
+	return &Logger{format: strings.ToUpper(format), w: w}
+}
+
+// Write writes the record as a single line.
+func (l *Logger) Write(r Record) error {
+	var line []byte
+	if l.format == FormatCombined {
+		line = []byte(combined(r))
+	} else {
+		var err error
+		line, err = json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+	}
+
+	// a record must be written in one call, so concurrent requests never interleave within a line
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, err := l.w.Write(line)
+	return err
+}
+
+// combined formats the record in the Apache combined log format.
+func combined(r Record) string {
+	b := "-"
+	if r.Bytes > 0 {
+		b = strconv.FormatInt(r.Bytes, 10)
+	}
+	return r.ClientIP + " - - [" + r.Time.Format("02/Jan/2006:15:04:05 -0700") + "] " +
+		strconv.Quote(r.Method+" "+r.Path+" "+r.Protocol) + " " + strconv.Itoa(r.Status) + " " + b + " " +
+		quoteOrDash(r.Referer) + " " + quoteOrDash(r.UserAgent) + "\n"
+}
+
+func quoteOrDash(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func testRecord() Record {
+	return Record{
+		Time:      time.Date(2025, time.March, 31, 13, 55, 36, 0, time.UTC),
+		ClientIP:  "192.0.2.10",
+		Method:    "GET",
+		Host:      "example.com",
+		Path:      "/blog/post?page=2",
+		Protocol:  "HTTP/1.1",
+		UserAgent: "Mozilla/5.0 (compatible; GPTBot/1.0)",
+		BotName:   "GPTBot",
+		Source:    "https://example.com/robots.json",
+		Action:    "BLOCK",
+		Status:    403,
+		Bytes:     128,
+	}
+}
+
+// TestWriteNDJSON tests that a record is written as a single line of JSON
+func TestWriteNDJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := New(out, "ndjson").Write(testRecord())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(out.Bytes(), []byte("\n")) != 1 {
+		t.Errorf("expected a single line to be written, got '%s'", out.String())
+	}
+	var got Record
+	err = json.Unmarshal(out.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != testRecord() {
+		t.Errorf("decoded record did not match the written record. Got %+v", got)
+	}
+}
+
+// TestWriteCombined tests that a record is written in the Apache combined log format
+func TestWriteCombined(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := New(out, FormatCombined).Write(testRecord())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `192.0.2.10 - - [31/Mar/2025:13:55:36 +0000] "GET /blog/post?page=2 HTTP/1.1" 403 128 "-" "Mozilla/5.0 (compatible; GPTBot/1.0)"` + "\n"
+	if out.String() != want {
+		t.Errorf("combined log line did not match. Wanted '%s', Got '%s'", want, out.String())
+	}
+}
@@ -4,7 +4,11 @@ package botmanager
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"text/template"
@@ -16,6 +20,8 @@ import (
 	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/parser"
 )
 
+const bytesPerMegabyte = 1024 * 1024
+
 var (
 	errBotManagerNoInit = errors.New("attempted to search uninitialized BotManager. Ensure it is created with the New() constructor")
 )
@@ -62,24 +68,42 @@ func (c *userAgentCache) set(k string, v string) {
 	c.cursor++
 }
 
+// RefreshHook is called after each attempt to refresh the bot index, with the error if the refresh failed.
+// Hooks are called while the index is locked, so must not block.
+type RefreshHook func(err error)
+
 // BotUAManager acts as a management layer around checking the current bot index, querying the index source, and refreshing the cache.
 type BotUAManager struct {
 	ahoCorasick         *ahocorasick.Node
 	botIndex            parser.RobotsIndex
 	cache               *userAgentCache
+	cacheHits           int
+	cacheMisses         int
 	cacheUpdateInterval time.Duration
+	diffHooks           []DiffHook
+	lastModified        time.Time
 	lock                sync.Mutex
 	log                 *logger.Log
 	nextUpdate          time.Time
-	searchFast          bool
-	sources             []parser.Source
-	sourceRetryInterval time.Duration
-	template            *template.Template
-	templateCache       *bytes.Buffer
+	// patterns is the names of the bots defined by a pattern, which are searched after those matched by name
+	patterns               []string
+	pool                   *parser.SourcePool
+	refreshHooks           []RefreshHook
+	reservedPaths          []string
+	searchFast             bool
+	sitemaps               []string
+	sources                []parser.Source
+	sourceRetryInterval    time.Duration
+	sourceRetryMaxInterval time.Duration
+	sourceStates           map[string]*sourceState
+	statsLock              sync.Mutex
+	template               *template.Template
+	// templateCache holds the rendered robots.txt for each scheme and host it was requested for
+	templateCache *userAgentCache
 }
 
 func loadTemplate(disallowAll bool, templatePath string, log *logger.Log) (*template.Template, error) {
-	t := template.New("robots.txt")
+	t := template.New("robots.txt").Funcs(templateFuncs())
 	var loadedT *template.Template
 	var err error
 	switch {
@@ -95,64 +119,134 @@ func loadTemplate(disallowAll bool, templatePath string, log *logger.Log) (*temp
 	return loadedT, err
 }
 
-// New initializes a BotUAManager instance.
-func New(source string, cacheInt string, l *logger.Log, cS int, sF bool, disallowAll bool, templatePath string, srcInt string) (*BotUAManager, error) {
+// New initializes a BotUAManager instance from the provided (validated) plugin configuration.
+func New(c *config.Config, l *logger.Log) (*BotUAManager, error) {
+	return NewWithPool(c, l, parser.NewSourcePool())
+}
+
+// newSource creates a parser.Source from its (validated) configuration, building its HTTP client.
+func newSource(s config.RobotsSource) (parser.Source, error) {
+	// we validated the time durations earlier, so ignore any error now
+	cDur, _ := time.ParseDuration(s.ConnectTimeout)
+	tDur, _ := time.ParseDuration(s.Timeout)
+	// the config's formats share their names with the parser's, other than AUTO which leaves the format to be detected
+	format := strings.ToUpper(s.Format)
+	if format == config.SourceFormatAuto {
+		format = ""
+	}
+	o := parser.ClientOptions{CAFile: s.CAFile, ProxyURL: s.ProxyURL, ConnectTimeout: cDur, Timeout: tDur}
+	client, err := parser.NewClient(o)
+	if err != nil {
+		return parser.Source{}, fmt.Errorf("unable to create HTTP client for source '%s'. %w", s.URL, err)
+	}
+	return parser.Source{
+		URL:             s.URL,
+		SHA256:          s.SHA256,
+		PublicKey:       s.PublicKey,
+		SignatureURL:    s.SignatureURL,
+		Client:          client,
+		ClientOptions:   o,
+		Headers:         s.Headers,
+		BearerTokenFile: s.BearerTokenFile,
+		MaxSize:         int64(s.MaxSize) * bytesPerMegabyte,
+		Format:          format,
+	}, nil
+}
+
+// NewWithPool initializes a BotUAManager instance that retrieves its sources through the provided SourcePool, which may be shared with other instances.
+func NewWithPool(c *config.Config, l *logger.Log, p *parser.SourcePool) (*BotUAManager, error) {
 	// we validated the time durations earlier, so ignore any error now
-	iDur, _ := time.ParseDuration(cacheInt)
-	sDur, _ := time.ParseDuration(srcInt)
-	uL := strings.Split(source, ",")
-	sources := make([]parser.Source, len(uL))
-	for i, u := range uL {
-		sources[i] = parser.Source{URL: u}
-	}
-	t, err := loadTemplate(disallowAll, templatePath, l)
+	iDur, _ := time.ParseDuration(c.CacheUpdateInterval)
+	sDur, _ := time.ParseDuration(c.RobotsSourceRetryInterval)
+	mDur, _ := time.ParseDuration(c.RobotsSourceRetryMaxInterval)
+	// sources are merged from lowest to highest priority, in the order configured for those with the same priority
+	sourceList := slices.Clone(c.SourceList())
+	sort.SliceStable(sourceList, func(i, j int) bool { return sourceList[i].Priority < sourceList[j].Priority })
+	var sources []parser.Source
+	states := make(map[string]*sourceState)
+	for _, s := range sourceList {
+		src, err := newSource(s)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+		// we validated the time duration earlier, so ignore any error now
+		sIDur, _ := time.ParseDuration(s.Interval)
+		states[s.URL] = &sourceState{interval: sIDur, merge: strings.ToUpper(s.Merge), status: SourceStatus{URL: s.URL}}
+	}
+	t, err := loadTemplate(c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, l)
 	if err != nil {
 		return nil, err
 	}
 	bI := make(parser.RobotsIndex)
 
+	// paths we serve ourselves and never want crawled by anyone
+	var reserved []string
+	if c.UsesAction(config.BotActionMaze) {
+		reserved = append(reserved, c.BotMazePathPrefix)
+	}
+	var sitemaps []string
+	for _, sm := range strings.Split(c.RobotsTXTSitemaps, ",") {
+		sm = strings.TrimSpace(sm)
+		if sm != "" {
+			sitemaps = append(sitemaps, sm)
+		}
+	}
+
 	uAMan := BotUAManager{
-		botIndex:            bI,
-		cache:               newUserAgentCache(cS),
-		cacheUpdateInterval: iDur,
-		log:                 l,
-		nextUpdate:          time.Now(),
-		sources:             sources,
-		sourceRetryInterval: sDur,
-		searchFast:          sF,
-		template:            t,
-		templateCache:       &bytes.Buffer{},
+		botIndex:               bI,
+		cache:                  newUserAgentCache(c.CacheSize),
+		cacheUpdateInterval:    iDur,
+		log:                    l,
+		nextUpdate:             time.Now(),
+		pool:                   p,
+		reservedPaths:          reserved,
+		sources:                sources,
+		sourceRetryInterval:    sDur,
+		sourceRetryMaxInterval: mDur,
+		sourceStates:           states,
+		searchFast:             c.UseFastMatch,
+		sitemaps:               sitemaps,
+		template:               t,
+		templateCache:          newUserAgentCache(c.CacheSize),
 	}
 	err = uAMan.refreshBotIndex()
 	return &uAMan, err
 }
 
 // RenderRobotsTxt renders and writes the current Robots Exclusion list into the request's response.
-func (b *BotUAManager) RenderRobotsTxt(w io.Writer, useCache bool) error {
+// The request provides the host and scheme to the template, and may be nil when rendering outside of a request.
+func (b *BotUAManager) RenderRobotsTxt(w io.Writer, r *http.Request, useCache bool) error {
 	err := b.refreshBotIndex()
 	if err != nil {
 		return err
 	}
 	if !useCache {
-		uAList := make([]string, len(b.botIndex))
-		i := 0
-		for k := range b.botIndex {
-			uAList[i] = k
-			i++
-		}
-		err = b.template.Execute(w, map[string][]string{
-			"UserAgentList": uAList,
-		})
-	} else {
-		cacheCopy := &bytes.Buffer{}
-		tee := io.TeeReader(b.templateCache, cacheCopy)
-		_, err = io.Copy(w, tee)
-		b.templateCache = cacheCopy
+		return b.renderTemplate(w, r)
 	}
 
+	k := templateKey(r)
+	rendered, hit := b.templateCache.get(k)
+	if !hit {
+		buf := &bytes.Buffer{}
+		err = b.renderTemplate(buf, r)
+		if err != nil {
+			return err
+		}
+		rendered = buf.String()
+		b.templateCache.set(k, rendered)
+	}
+	_, err = io.WriteString(w, rendered)
 	return err
 }
 
+// OnRefresh registers a hook to be called after each attempt to refresh the bot index.
+func (b *BotUAManager) OnRefresh(h RefreshHook) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refreshHooks = append(b.refreshHooks, h)
+}
+
 // Search checks if the provided user-agent has a (partial) match in the botIndex.
 func (b *BotUAManager) Search(u string) (string, parser.BotUserAgent, error) {
 	var botName string
@@ -167,15 +261,12 @@ func (b *BotUAManager) Search(u string) (string, parser.BotUserAgent, error) {
 	}
 
 	botName, hit := b.cache.get(u)
+	b.recordSearch(hit)
 	if hit {
 		b.log.Debug("Search: cache hit, got '"+botName+"'", "userAgent", u)
 	} else {
 		b.log.Debug("Search: cache miss", "userAgent", u)
-		if b.searchFast {
-			botName = b.fastSearch(u)
-		} else {
-			botName = b.slowSearch(u)
-		}
+		botName = b.search(u)
 		b.cache.set(u, botName)
 	}
 	return botName, b.botIndex[botName], nil
@@ -189,14 +280,7 @@ func (b *BotUAManager) refreshBotIndex() error {
 	defer b.lock.Unlock()
 	if time.Now().Compare(b.nextUpdate) >= 0 {
 		b.log.Info("refreshBotIndex: cache expired, updating")
-		err = b.update()
-		if err != nil {
-			b.nextUpdate = time.Now().Add(b.sourceRetryInterval)
-			b.log.Warn("refreshBotIndex: cache failed to refresh, will retry after " + b.nextUpdate.Format(time.RFC1123) + ". Error: " + err.Error())
-		} else {
-			b.nextUpdate = time.Now().Add(b.cacheUpdateInterval)
-			b.log.Debug("refreshBotIndex: cache refreshed, next update due " + b.nextUpdate.Format(time.RFC1123))
-		}
+		_, err = b.applyUpdate(false)
 	} else {
 		b.log.Debug("refreshBotIndex: cache has not expired. Next update due " + b.nextUpdate.Format(time.RFC1123))
 	}
@@ -208,11 +292,63 @@ func (b *BotUAManager) refreshBotIndex() error {
 	return err
 }
 
+// Refresh updates the bot index immediately, ignoring when the next update is due and any source data shared through the pool.
+// Returns the changes made to the index.
+func (b *BotUAManager) Refresh() (Diff, error) {
+	b.InvalidateSources()
+	return b.RefreshPooled()
+}
+
+// InvalidateSources discards the source data shared through the pool, so that the next consumer of each source retrieves it again.
+func (b *BotUAManager) InvalidateSources() {
+	for _, s := range b.sources {
+		b.pool.Invalidate(s.URL)
+	}
+}
+
+// RefreshPooled updates the bot index immediately, ignoring when the next update is due, but using any source data shared through the pool.
+// To refresh several BotUAManagers sharing a pool, invalidate each one's sources first, so that a shared source is only retrieved once.
+// Returns the changes made to the index.
+func (b *BotUAManager) RefreshPooled() (Diff, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.log.Info("Refresh: forced refresh requested, updating")
+	return b.applyUpdate(true)
+}
+
+// applyUpdate runs an update of the sources that are due, or all of them if forced, schedules the next one, and notifies any hooks.
+// Returns the changes made to the index. The caller must hold the lock.
+func (b *BotUAManager) applyUpdate(force bool) (Diff, error) {
+	initial := b.lastModified.IsZero()
+	prev := b.botIndex
+	err := b.update(force)
+	d := diffIndex(prev, b.botIndex)
+	if !initial && !d.Empty() {
+		b.logDiff(d, prev)
+		for _, h := range b.diffHooks {
+			h(d)
+		}
+	}
+	b.nextUpdate = b.nextSourceAttempt()
+	if err != nil {
+		b.log.Warn("refreshBotIndex: cache failed to refresh, will retry after " + b.nextUpdate.Format(time.RFC1123) + ". Error: " + err.Error())
+	} else {
+		b.log.Debug("refreshBotIndex: cache refreshed, next update due " + b.nextUpdate.Format(time.RFC1123))
+	}
+	for _, h := range b.refreshHooks {
+		h(err)
+	}
+	return d, err
+}
+
 // slowSearch runs a substring search in a simple for loop.
 func (b *BotUAManager) slowSearch(u string) string {
 	var match bool
 	var nameMatch string
-	for name := range b.botIndex {
+	for name, v := range b.botIndex {
+		if v.Pattern != nil {
+			continue
+		}
 		match = strings.Contains(u, name)
 		if match {
 			nameMatch = name
@@ -228,36 +364,85 @@ func (b *BotUAManager) fastSearch(u string) string {
 	return s
 }
 
-// update fetches the latest robots.txt index from each configured source, merges them, stores it, and updates the timestamp.
-func (b *BotUAManager) update() error {
-	newI := parser.RobotsIndex{}
+// update fetches the latest robots.txt index from each source that is due (or every source, if forced), merges them, stores it, and updates the timestamp.
+// A source that fails keeps contributing the last index retrieved from it.
+func (b *BotUAManager) update(force bool) error {
+	now := time.Now()
+	var errs []error
+	retrieved := false
 	for _, s := range b.sources {
-		n, err := s.GetIndex()
-		if err != nil {
-			return err
+		st := b.state(s.URL)
+		if !force && now.Before(st.status.NextAttempt) {
+			continue
 		}
-		// could use golang.org/x/exp/maps, but this saves us a dep
-		//nolint:modernize
-		for k, v := range n {
-			newI[k] = v
+		// refreshes are jittered, so an index shared through the pool must expire well before the next one is due
+		n, warnings, err := b.pool.GetIndex(s, b.interval(st)/2)
+		for _, w := range warnings {
+			b.log.Warn("refreshBotIndex: skipped part of source", "source", s.URL, "warning", w.String())
+		}
+		b.recordSource(st, n, err)
+		if err != nil {
+			errs = append(errs, err)
+			continue
 		}
+		retrieved = true
+	}
+	// a source that failed keeps contributing the last index retrieved from it
+	if !retrieved {
+		return errors.Join(errs...)
+	}
+	newI := parser.RobotsIndex{}
+	for _, s := range b.sources {
+		st := b.state(s.URL)
+		mergeIndex(newI, st.index, st.merge)
 	}
 	b.botIndex = newI
+	b.patterns = patternNames(b.botIndex)
 	if b.searchFast {
-		b.ahoCorasick = ahocorasick.NewFromIndex(b.botIndex)
+		b.ahoCorasick = ahocorasick.NewFromIndex(literalIndex(b.botIndex))
 	}
 	b.cache = newUserAgentCache(b.cache.limit)
 
-	uAList := make([]string, len(b.botIndex))
-	i := 0
-	for k := range b.botIndex {
-		uAList[i] = k
-		i++
+	// render once without a request, so a broken template is reported during the refresh
+	prev, _ := b.templateCache.get(templateKey(nil))
+	b.templateCache = newUserAgentCache(b.templateCache.limit)
+	buf := &bytes.Buffer{}
+	err := b.renderTemplate(buf, nil)
+	if err != nil {
+		return err
+	}
+	b.templateCache.set(templateKey(nil), buf.String())
+	// only a change in content should invalidate copies of the robots.txt cached by clients
+	if buf.String() != prev || b.lastModified.IsZero() {
+		b.lastModified = time.Now()
 	}
-	b.templateCache.Reset()
-	err := b.template.Execute(b.templateCache, map[string][]string{
-		"UserAgentList": uAList,
-	})
+	return errors.Join(errs...)
+}
 
-	return err
+// LastModified returns the time the rendered robots.txt last changed.
+func (b *BotUAManager) LastModified() time.Time {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.lastModified
+}
+
+// renderTemplate executes the robots.txt template against the current index, and appends a group for any reserved paths.
+func (b *BotUAManager) renderTemplate(w io.Writer, r *http.Request) error {
+	err := b.template.Execute(w, b.templateData(r))
+	if err != nil || len(b.reservedPaths) == 0 {
+		return err
+	}
+
+	// RFC 9309 merges groups for the same user-agent, so this is safe to add even if the template already has a wildcard group
+	_, err = io.WriteString(w, "\nUser-agent: *\n")
+	if err != nil {
+		return err
+	}
+	for _, p := range b.reservedPaths {
+		_, err = io.WriteString(w, "Disallow: "+p+"\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -17,10 +17,17 @@ const (
 
 var (
 	log   = logger.NewFromWriter("ERROR", &testLogOut)
-	c     = config.New()
-	bM, _ = New(exampleSource, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	c     = benchmarkConfig()
+	bM, _ = New(c, log)
 )
 
+// benchmarkConfig is a helper function to generate the default configuration pointed at the example source
+func benchmarkConfig() *config.Config {
+	c := config.New()
+	c.RobotsSourceURL = exampleSource
+	return c
+}
+
 func BenchmarkSimpleSearchShort(b *testing.B) {
 	// yaegi doesn't like a range over int loop
 	// https://github.com/traefik/yaegi/issues/1701
@@ -51,12 +58,12 @@ func BenchmarkAhoCorsasickSearchLong(b *testing.B) {
 func BenchmarkRobotsTxtRenderCache(b *testing.B) {
 	for i := 0; i < b.N; i++ { //nolint:intrange,modernize
 		w := &bytes.Buffer{}
-		_ = bM.RenderRobotsTxt(w, true)
+		_ = bM.RenderRobotsTxt(w, nil, true)
 	}
 }
 func BenchmarkRobotsTxtRenderNoCache(b *testing.B) {
 	for i := 0; i < b.N; i++ { //nolint:intrange,modernize
 		w := &bytes.Buffer{}
-		_ = bM.RenderRobotsTxt(w, false)
+		_ = bM.RenderRobotsTxt(w, nil, false)
 	}
 }
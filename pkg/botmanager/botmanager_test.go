@@ -2,12 +2,17 @@ package botmanager
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"regexp"
 	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,7 +29,7 @@ func TestNewBotManager(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	tStart := time.Now()
 	c := config.New()
-	b, err := New(c.RobotsSourceURL, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	b, err := New(c, log)
 	if err != nil {
 		t.Error("unexpected error when initializing default bot manager: " + err.Error())
 	}
@@ -41,7 +46,7 @@ func TestNewBotManagerDisallowAll(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	c := config.New()
 	c.RobotsTXTDisallowAll = true
-	_, err := New(c.RobotsSourceURL, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	_, err := New(c, log)
 	if err != nil {
 		t.Error("unexpected error when initializing bot manager with RobotsTXTDisallowAll: " + err.Error())
 	}
@@ -60,7 +65,8 @@ func TestBotManagerBadURL(t *testing.T) {
 
 	for _, u := range urls {
 		t.Run(u, func(t *testing.T) {
-			_, err := New(u, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+			c.RobotsSourceURL = u
+			_, err := New(c, log)
 			if err == nil {
 				t.Error("problematic RobotsSourceURL did not return an error when initializing BotUAManager: " + u)
 			}
@@ -72,7 +78,7 @@ func TestBotManagerBadURL(t *testing.T) {
 func TestGetBotIndex(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	c := config.New()
-	b, _ := New(c.RobotsSourceURL, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	b, _ := New(c, log)
 	_ = b.refreshBotIndex()
 	if len(b.botIndex) == 0 {
 		t.Error("robots index with default configuration was empty")
@@ -92,7 +98,8 @@ func TestGetBotIndexMulti(t *testing.T) {
 	c := config.New()
 	u := "https://cdn.jsdelivr.net/gh/ai-robots-txt/ai.robots.txt@latest/robots.json" + "," + "https://cdn.jsdelivr.net/gh/mitchellkrogza/nginx-ultimate-bad-bot-blocker@latest/robots.txt/robots.txt"
 
-	b, _ := New(u, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	c.RobotsSourceURL = u
+	b, _ := New(c, log)
 	_ = b.refreshBotIndex()
 	gotL := len(b.botIndex)
 	// approximate ai robots json at > 100 entries, bad bots at 50+
@@ -107,7 +114,7 @@ func TestBotIndexCacheRefresh(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	c := config.New()
 	c.CacheUpdateInterval = "5ns"
-	b, _ := New(c.RobotsSourceURL, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	b, _ := New(c, log)
 	_ = b.refreshBotIndex()
 	firstUpdate := b.nextUpdate
 
@@ -124,7 +131,7 @@ func TestBotIndexBadUpdate(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	c := config.New()
 	c.CacheUpdateInterval = "5ns"
-	b, _ := New(c.RobotsSourceURL, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	b, _ := New(c, log)
 	_ = b.refreshBotIndex()
 	firstIndex := &b.botIndex
 
@@ -158,24 +165,31 @@ func TestRobotSourceRetryInterval(t *testing.T) {
 		}
 	}))
 
-	b, _ := New(s.URL, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	c.RobotsSourceURL = s.URL
+	b, _ := New(c, log)
+	// retries are jittered, but never scheduled later than robotsSourceRetryInterval after the first failure
+	firstRetry := b.state(s.URL).status.NextAttempt
+	if firstRetry.After(time.Now().Add(b.sourceRetryInterval)) {
+		t.Error("BotUAManager scheduled the first retry of a failed source later than robotsSourceRetryInterval")
+	}
 	attempts := 3
 	// yaegi doesn't like a range over int loop
 	// https://github.com/traefik/yaegi/issues/1701
 	for i := 0; i < attempts; i++ { //nolint:intrange,modernize
 		time.Sleep(b.cacheUpdateInterval)
 		_ = b.refreshBotIndex()
-		if requestCount != 1 {
+		if time.Now().Before(firstRetry) && requestCount != 1 {
 			t.Error("BotUAManager attempted to retry a failed source update too soon")
 		}
 		if len(b.botIndex) != 0 {
 			t.Error("BotUAManager unexpectedly populated botindex from invalid source")
 		}
 	}
-	time.Sleep(b.sourceRetryInterval)
+	time.Sleep(time.Until(b.nextUpdate))
+	before := requestCount
 	b.sources = []parser.Source{{URL: s.URL + "/robots.txt"}}
 	_ = b.refreshBotIndex()
-	if requestCount != 2 {
+	if requestCount != before+1 {
 		t.Error("BotUAManager did not retry requesting a source update after robotsSourceRetryInterval")
 	}
 	if len(b.botIndex) > 0 {
@@ -187,7 +201,8 @@ func TestRobotSourceRetryInterval(t *testing.T) {
 func TestBotIndexSearchCache(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	c := config.New()
-	bM, _ := New(exampleSource, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	c.RobotsSourceURL = exampleSource
+	bM, _ := New(c, log)
 	botName, _, err := bM.Search(exampleLongString)
 	if err != nil {
 		t.Errorf("unexpected error when performing a search for '%s': %s", exampleLongString, err.Error())
@@ -210,7 +225,8 @@ func TestBotIndexSearchCacheRollover(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	c := config.New()
 	c.CacheSize = 1
-	bM, _ := New(exampleSource, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	c.RobotsSourceURL = exampleSource
+	bM, _ := New(c, log)
 
 	bM.cache.set(exampleLongString, "")
 	bM.cache.set(exampleShortString, "")
@@ -226,7 +242,8 @@ func TestBotIndexSearchBadRefresh(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	c := config.New()
 	c.CacheUpdateInterval = "1ns"
-	b, err := New(exampleSource, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	c.RobotsSourceURL = exampleSource
+	b, err := New(c, log)
 	if err != nil {
 		t.Fatal("unexpected error constructing botmanager instance")
 	}
@@ -245,7 +262,8 @@ func TestBotIndexSearchSlow(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	c := config.New()
 	c.UseFastMatch = false
-	bM, _ := New(exampleSource, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	c.RobotsSourceURL = exampleSource
+	bM, _ := New(c, log)
 	botName, _, err := bM.Search(exampleLongString)
 	if err != nil {
 		t.Errorf("unexpected error when performing a slow search for '%s': %s", exampleLongString, err.Error())
@@ -259,7 +277,8 @@ func TestBotIndexSearchSlow(t *testing.T) {
 func TestBotIndexSearchFast(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	c := config.New()
-	bM, _ := New(exampleSource, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	c.RobotsSourceURL = exampleSource
+	bM, _ := New(c, log)
 	bM.ahoCorasick = ahocorasick.NewFromIndex(bM.botIndex)
 	botName, _, err := bM.Search(exampleLongString)
 	if err != nil {
@@ -285,7 +304,7 @@ func TestInitBadRobotsTxt(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	c := config.New()
 	c.RobotsTXTFilePath = "filenotexist.txt"
-	_, err := New(c.RobotsSourceURL, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	_, err := New(c, log)
 	if err == nil {
 		t.Error("New() did not return an error when provided invalid robots.txt file")
 	}
@@ -304,13 +323,13 @@ func (f *badResponseWriter) Write(_ []byte) (int, error) {
 func TestInitBadRobotsTemplate(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	c := config.New()
-	b, err := New(c.RobotsSourceURL, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	b, err := New(c, log)
 	if err != nil {
 		t.Fatal("unexpected error constructing botmanager instance")
 	}
 
 	w := &badResponseWriter{}
-	err = b.RenderRobotsTxt(w, true)
+	err = b.RenderRobotsTxt(w, nil, true)
 
 	if err == nil {
 		t.Error("RenderRobotsTxt() did not return an error when provided bad writer to write template content into")
@@ -323,13 +342,13 @@ func TestRenderRobotsTxtCustomTemplate(t *testing.T) {
 	c := config.New()
 	// use example template in root
 	c.RobotsTXTFilePath = "../../robots.txt"
-	b, err := New(c.RobotsSourceURL, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	b, err := New(c, log)
 	if err != nil {
 		t.Error("Initializing the botmanager with a custom RobotsTXTFilePath failed: " + err.Error())
 	}
 
 	w := &bytes.Buffer{}
-	err = b.RenderRobotsTxt(w, true)
+	err = b.RenderRobotsTxt(w, nil, true)
 
 	if err != nil {
 		t.Error("RenderRobotsTxt() with a custom template was not successful: " + err.Error())
@@ -341,7 +360,7 @@ func TestRenderRobotsTxtBadRefresh(t *testing.T) {
 	log := logger.NewFromWriter("DEBUG", &testLogOut)
 	c := config.New()
 	c.CacheUpdateInterval = "1ns"
-	b, err := New(c.RobotsSourceURL, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	b, err := New(c, log)
 	if err != nil {
 		t.Fatal("unexpected error constructing botmanager instance")
 	}
@@ -349,7 +368,7 @@ func TestRenderRobotsTxtBadRefresh(t *testing.T) {
 	time.Sleep(b.cacheUpdateInterval)
 	b.sources = []parser.Source{{URL: "http://localhost"}}
 	w := &bytes.Buffer{}
-	err = b.RenderRobotsTxt(w, true)
+	err = b.RenderRobotsTxt(w, nil, true)
 
 	if err == nil {
 		t.Error("RenderRobotsTxt() did not return an error when a source refresh failed during render")
@@ -368,16 +387,17 @@ func TestRenderRobotsTxt(t *testing.T) {
 		`
 		_, _ = w.Write([]byte(sampleTxt))
 	}))
-	bM, _ := New(s.URL+"/robots.txt", c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	c.RobotsSourceURL = s.URL + "/robots.txt"
+	bM, _ := New(c, log)
 
 	w := &bytes.Buffer{}
-	err := bM.RenderRobotsTxt(w, true)
+	err := bM.RenderRobotsTxt(w, nil, true)
 	if err != nil {
 		t.Error("unexpected error returned from RenderRobotsTxt: " + err.Error())
 	}
 
 	rendered := w.String()
-	cached := bM.templateCache.String()
+	cached, _ := bM.templateCache.get(templateKey(nil))
 	hasUserAgent := strings.Contains(rendered, "User-agent: GPTBot")
 	hasRule := strings.Contains(rendered, "Disallow: /")
 
@@ -401,17 +421,18 @@ func TestRenderRobotsTxtNoCache(t *testing.T) {
 		`
 		_, _ = w.Write([]byte(sampleTxt))
 	}))
-	bM, _ := New(s.URL+"/robots.txt", c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	c.RobotsSourceURL = s.URL + "/robots.txt"
+	bM, _ := New(c, log)
 
-	bM.templateCache = &bytes.Buffer{}
+	bM.templateCache.set(templateKey(nil), "")
 	w := &bytes.Buffer{}
-	err := bM.RenderRobotsTxt(w, false)
+	err := bM.RenderRobotsTxt(w, nil, false)
 	if err != nil {
 		t.Error("unexpected error returned from RenderRobotsTxt: " + err.Error())
 	}
 
 	rendered := w.String()
-	cached := bM.templateCache.String()
+	cached, _ := bM.templateCache.get(templateKey(nil))
 	hasUserAgent := strings.Contains(rendered, "User-agent: GPTBot")
 	hasRule := strings.Contains(rendered, "Disallow: /")
 
@@ -437,10 +458,11 @@ Disallow: /
 `
 		_, _ = w.Write([]byte(sampleTxt))
 	}))
-	bM, _ := New(s.URL+"/robots.txt", c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	c.RobotsSourceURL = s.URL + "/robots.txt"
+	bM, _ := New(c, log)
 
 	w1 := &bytes.Buffer{}
-	err := bM.RenderRobotsTxt(w1, true)
+	err := bM.RenderRobotsTxt(w1, nil, true)
 	if err != nil {
 		t.Error("unexpected error returned from RenderRobotsTxt: " + err.Error())
 	}
@@ -449,7 +471,7 @@ Disallow: /
 	_ = bM.refreshBotIndex()
 
 	w2 := &bytes.Buffer{}
-	err = bM.RenderRobotsTxt(w2, true)
+	err = bM.RenderRobotsTxt(w2, nil, true)
 	if err != nil {
 		t.Error("unexpected error returned from RenderRobotsTxt: " + err.Error())
 	}
@@ -463,3 +485,380 @@ Disallow: /
 		}
 	}
 }
+
+// TestRenderRobotsTxtMazeDisallow tests that the maze path prefix is disallowed in the rendered robots.txt when the MAZE action is used
+func TestRenderRobotsTxtMazeDisallow(t *testing.T) {
+	log := logger.NewFromWriter("DEBUG", &testLogOut)
+	c := config.New()
+	c.BotAction = config.BotActionMaze
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("User-agent: GPTBot\nDisallow: /\n"))
+	}))
+	defer s.Close()
+	c.RobotsSourceURL = s.URL + "/robots.txt"
+	bM, err := New(c, log)
+	if err != nil {
+		t.Fatal("unexpected error constructing botmanager instance: " + err.Error())
+	}
+
+	w := &bytes.Buffer{}
+	err = bM.RenderRobotsTxt(w, nil, true)
+	if err != nil {
+		t.Error("unexpected error returned from RenderRobotsTxt: " + err.Error())
+	}
+	want := "User-agent: *\nDisallow: " + c.BotMazePathPrefix + "\n"
+	if !strings.Contains(w.String(), want) {
+		t.Errorf("rendered robots.txt did not disallow the maze prefix. Wanted: '%s', Got: '%s'", want, w.String())
+	}
+}
+
+// TestRenderRobotsTxtTemplateData tests that a custom template has access to the bot metadata, request, sitemaps, and helper functions
+func TestRenderRobotsTxtTemplateData(t *testing.T) {
+	log := logger.NewFromWriter("DEBUG", &testLogOut)
+	c := config.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"GPTBot": {"operator": "OpenAI", "respect": "Yes", "function": "test", "frequency": "test", "description": "test"},
+			"ChatGPT-User": {"operator": "OpenAI", "respect": "Yes", "function": "test", "frequency": "test", "description": "test"},
+			"ClaudeBot": {"operator": "Anthropic", "respect": "Yes", "function": "test", "frequency": "test", "description": "test"}
+		}`))
+	}))
+	defer s.Close()
+	c.RobotsSourceURL = s.URL
+	c.RobotsTXTSitemaps = "/sitemap.xml,https://cdn.example.com/sitemap.xml"
+	c.RobotsTXTFilePath = t.TempDir() + "/robots.txt"
+	tmpl := `{{ range $op, $bots := groupBy "operator" .Bots }}# {{ lower $op }}: {{ len $bots }}
+{{ end }}{{ .UserAgentList | sortAlpha | join "," }}
+{{ range .Sitemaps }}Sitemap: {{ . }}
+{{ end }}`
+	err := os.WriteFile(c.RobotsTXTFilePath, []byte(tmpl), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bM, err := New(c, log)
+	if err != nil {
+		t.Fatal("unexpected error constructing botmanager instance: " + err.Error())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/robots.txt", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w := &bytes.Buffer{}
+	err = bM.RenderRobotsTxt(w, req, true)
+	if err != nil {
+		t.Fatal("unexpected error returned from RenderRobotsTxt: " + err.Error())
+	}
+	want := "# anthropic: 1\n# openai: 2\nChatGPT-User,ClaudeBot,GPTBot\nSitemap: https://example.com/sitemap.xml\nSitemap: https://cdn.example.com/sitemap.xml\n"
+	if w.String() != want {
+		t.Errorf("rendered robots.txt did not match. Wanted: '%s', Got: '%s'", want, w.String())
+	}
+
+	// a different host must not be served the first host's cached copy
+	req = httptest.NewRequest(http.MethodGet, "http://other.example.com/robots.txt", nil)
+	w.Reset()
+	err = bM.RenderRobotsTxt(w, req, true)
+	if err != nil {
+		t.Fatal("unexpected error returned from RenderRobotsTxt: " + err.Error())
+	}
+	if !strings.Contains(w.String(), "Sitemap: http://other.example.com/sitemap.xml") {
+		t.Errorf("rendered robots.txt did not resolve the sitemap against the request host. Got: '%s'", w.String())
+	}
+}
+
+// TestRenderRobotsTxtStableOrder tests that the rendered robots.txt lists user agents in the same, sorted, order every time
+func TestRenderRobotsTxtStableOrder(t *testing.T) {
+	log := logger.NewFromWriter("DEBUG", &testLogOut)
+	c := config.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("User-agent: GPTBot\nUser-agent: Bytespider\nUser-agent: CCBot\nUser-agent: ClaudeBot\nDisallow: /\n"))
+	}))
+	defer s.Close()
+	c.RobotsSourceURL = s.URL + "/robots.txt"
+	bM, err := New(c, log)
+	if err != nil {
+		t.Fatal("unexpected error constructing botmanager instance: " + err.Error())
+	}
+
+	want := "User-agent: Bytespider\nUser-agent: CCBot\nUser-agent: ClaudeBot\nUser-agent: GPTBot\nDisallow: /\n"
+	for i := 0; i < 5; i++ { //nolint:intrange,modernize
+		w := &bytes.Buffer{}
+		err = bM.RenderRobotsTxt(w, nil, false)
+		if err != nil {
+			t.Fatal("unexpected error returned from RenderRobotsTxt: " + err.Error())
+		}
+		if !strings.Contains(w.String(), want) {
+			t.Fatalf("rendered robots.txt was not in a stable order. Wanted: '%s', Got: '%s'", want, w.String())
+		}
+	}
+}
+
+// TestBotIndexDiff tests that refreshes report the bots added, removed, and changed to hooks, attributed to their source
+func TestBotIndexDiff(t *testing.T) {
+	log := logger.NewFromWriter("DEBUG", io.Discard)
+	c := config.New()
+	body := "User-agent: GPTBot\nUser-agent: CCBot\nDisallow: /\n"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer s.Close()
+	c.RobotsSourceURL = s.URL + "/robots.txt"
+	bM, err := New(c, log)
+	if err != nil {
+		t.Fatal("unexpected error constructing botmanager instance: " + err.Error())
+	}
+	var got []Diff
+	bM.OnChange(func(d Diff) {
+		got = append(got, d)
+	})
+
+	// an unchanged refresh should not call the hook
+	_, err = bM.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("expected no change to be reported, got %+v", got)
+	}
+
+	body = "User-agent: GPTBot\nDisallow: /private\n\nUser-agent: ClaudeBot\nDisallow: /\n"
+	d, err := bM.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected one change to be reported, got %+v", got)
+	}
+	src := s.URL + "/robots.txt"
+	want := Diff{
+		Added:   []BotChange{{Name: "ClaudeBot", Source: src}},
+		Removed: []BotChange{{Name: "CCBot", Source: src}},
+		Changed: []BotChange{{Name: "GPTBot", Source: src}},
+	}
+	for _, g := range []Diff{d, got[0]} {
+		if !slices.Equal(g.Added, want.Added) || !slices.Equal(g.Removed, want.Removed) || !slices.Equal(g.Changed, want.Changed) {
+			t.Errorf("unexpected diff. Wanted %+v, got %+v", want, g)
+		}
+	}
+	if bySrc := d.BySource(); len(bySrc) != 1 || len(bySrc[src].Changed) != 1 {
+		t.Errorf("expected the changes to be grouped under a single source, got %+v", bySrc)
+	}
+}
+
+// TestBotIndexDiffPattern tests that a bot whose pattern changes is reported as changed
+func TestBotIndexDiffPattern(t *testing.T) {
+	prev := parser.RobotsIndex{"wget": {Pattern: regexp.MustCompile(`[wW]get`)}, "curl": {}}
+	next := parser.RobotsIndex{"wget": {Pattern: regexp.MustCompile(`[wW]get\/[0-9]`)}, "curl": {}}
+	d := diffIndex(prev, next)
+	if len(d.Changed) != 1 || d.Changed[0].Name != "wget" || len(d.Added) != 0 || len(d.Removed) != 0 {
+		t.Errorf("expected only the bot with the new pattern to be reported as changed, got %+v", d)
+	}
+	if d = diffIndex(next, next); len(d.Changed) != 0 {
+		t.Errorf("expected an identical index to have no changes, got %+v", d)
+	}
+}
+
+// TestBotIndexIntegrityKeepsLastGood tests that a source failing verification is rejected, keeping the last index that passed
+func TestBotIndexIntegrityKeepsLastGood(t *testing.T) {
+	log := logger.NewFromWriter("DEBUG", io.Discard)
+	content := "User-agent: GPTBot\nDisallow: /\n"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(content))
+	}))
+	defer s.Close()
+	sum := sha256.Sum256([]byte(content))
+	c := config.New()
+	c.RobotsSources = []config.RobotsSource{{URL: s.URL + "/robots.txt", SHA256: hex.EncodeToString(sum[:])}}
+	bM, err := New(c, log)
+	if err != nil {
+		t.Fatal("unexpected error constructing botmanager instance: " + err.Error())
+	}
+
+	content = "User-agent: CCBot\nDisallow: /\n"
+	_, err = bM.Refresh()
+	if err == nil {
+		t.Fatal("expected tampered source to fail verification")
+	}
+	name, _, err := bM.Search("GPTBot/1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "GPTBot" {
+		t.Errorf("expected the last verified index to be kept, got match '%s'", name)
+	}
+	st := bM.Status()
+	if st.Sources[0].LastError == "" {
+		t.Error("expected the verification failure to be reported in the source status")
+	}
+}
+
+// TestSourceRetryBackoff tests that retries of a failing source back off exponentially up to the maximum interval, and are reported in its status
+func TestSourceRetryBackoff(t *testing.T) {
+	b := &BotUAManager{sourceRetryInterval: time.Second, sourceRetryMaxInterval: 5 * time.Second}
+	for failures, limit := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		for i := 0; i < 20; i++ { //nolint:intrange,modernize
+			d := b.retryDelay(failures)
+			if d < 0 || d > limit {
+				t.Fatalf("expected retry delay after %d failures to be within [0, %s], got %s", failures, limit, d)
+			}
+		}
+	}
+
+	log := logger.NewFromWriter("DEBUG", io.Discard)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+	c := config.New()
+	c.RobotsSourceURL = s.URL
+	bM, _ := New(c, log)
+	_, _ = bM.Refresh()
+	st := bM.Status().Sources[0]
+	if st.ConsecutiveFailures != 2 || st.NextAttempt.IsZero() {
+		t.Errorf("expected two consecutive failures and a scheduled retry in the source status, got %+v", st)
+	}
+}
+
+// TestSourceMergeStrategies tests that sources are merged in order of priority, using each source's merge strategy
+func TestSourceMergeStrategies(t *testing.T) {
+	log := logger.NewFromWriter("DEBUG", io.Discard)
+	rich := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"GPTBot": {"operator": "OpenAI", "respect": "Yes", "function": "Training", "frequency": "Daily", "description": "Trains models."}}`))
+	}))
+	defer rich.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("User-agent: GPTBot\nUser-agent: CCBot\nDisallow: /private\n"))
+	}))
+	defer plain.Close()
+
+	tests := []struct {
+		name       string
+		merge      string
+		priority   int
+		operator   string
+		disallow   []string
+		wantSource string
+	}{
+		{name: "Override", merge: "override", operator: "", disallow: []string{"/private"}, wantSource: plain.URL},
+		{name: "KeepFirst", merge: "KEEP_FIRST", operator: "OpenAI", wantSource: rich.URL},
+		{name: "Merge", merge: "MERGE", operator: "OpenAI", disallow: []string{"/private"}, wantSource: rich.URL},
+		// a lower priority source is merged first, so the rich source overrides it despite being listed first
+		{name: "Priority", merge: "OVERRIDE", priority: -1, operator: "OpenAI", wantSource: rich.URL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config.New()
+			c.RobotsSources = []config.RobotsSource{
+				{URL: rich.URL},
+				{URL: plain.URL, Merge: tt.merge, Priority: tt.priority},
+			}
+			err := c.ValidateConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+			bM, err := New(c, log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := bM.botIndex["GPTBot"]
+			if got.JSONMetadata.Operator != tt.operator || !slices.Equal(got.DisallowPath, tt.disallow) || got.Source != tt.wantSource {
+				t.Errorf("unexpected merged entry %+v", got)
+			}
+			if _, ok := bM.botIndex["CCBot"]; !ok {
+				t.Error("expected bots only in the lower precedence source to be added")
+			}
+		})
+	}
+}
+
+// TestSourceInterval tests that a source with its own interval is refreshed on that schedule, independently of other sources
+func TestSourceInterval(t *testing.T) {
+	log := logger.NewFromWriter("DEBUG", io.Discard)
+	var lock sync.Mutex
+	requests := map[string]int{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.URL.Path]++
+		lock.Unlock()
+		_, _ = w.Write([]byte("User-agent: " + strings.TrimPrefix(r.URL.Path, "/") + "\nDisallow: /\n"))
+	}))
+	defer s.Close()
+	c := config.New()
+	c.RobotsSources = []config.RobotsSource{{URL: s.URL + "/FastBot", Interval: "10ms"}, {URL: s.URL + "/SlowBot"}}
+	bM, err := New(c, log)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	_ = bM.refreshBotIndex()
+	lock.Lock()
+	defer lock.Unlock()
+	if requests["/FastBot"] != 2 || requests["/SlowBot"] != 1 {
+		t.Errorf("expected only the source with a short interval to be refreshed again, got %v", requests)
+	}
+	if len(bM.botIndex) != 2 {
+		t.Errorf("expected bots from both sources to remain in the index, got %v", bM.botIndex)
+	}
+}
+
+// TestSearchCrawlerPatterns tests that bots defined by a pattern are matched by it, after bots matched by name, and are left out of the robots.txt
+func TestSearchCrawlerPatterns(t *testing.T) {
+	log := logger.NewFromWriter("DEBUG", io.Discard)
+	crawlers := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[{"pattern": "[wW]get\\/[0-9]", "url": "https://www.gnu.org/software/wget/"}, {"pattern": "Bot"}]`))
+	}))
+	defer crawlers.Close()
+	names := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("User-agent: GPTBot\nDisallow: /\n"))
+	}))
+	defer names.Close()
+
+	for _, fast := range []bool{true, false} {
+		c := config.New()
+		c.UseFastMatch = fast
+		c.RobotsSources = []config.RobotsSource{{URL: crawlers.URL, Format: "crawler_user_agents"}, {URL: names.URL}}
+		err := c.ValidateConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bM, err := New(c, log)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ua, want := range map[string]string{
+			"Wget/1.21.4":                      `[wW]get\/[0-9]`,
+			"wget/2":                           `[wW]get\/[0-9]`,
+			"Wget":                             "",
+			"Mozilla/5.0 (compatible; GPTBot)": "GPTBot",
+			"SomeBot/1.0":                      "Bot",
+		} {
+			got, info, err := bM.Search(ua)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("fast=%t: expected '%s' to match '%s', got '%s'", fast, ua, want, got)
+			}
+			if got == `[wW]get\/[0-9]` && info.CrawlerMetadata.URL != "https://www.gnu.org/software/wget/" {
+				t.Errorf("expected crawler metadata to be returned, got %+v", info)
+			}
+		}
+		m, err := bM.Explain("Wget/1.0 wget/2.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(m.Offsets, [][2]int{{0, 6}, {9, 15}}) {
+			t.Errorf("expected offsets of each pattern match, got %v", m.Offsets)
+		}
+
+		var buf bytes.Buffer
+		err = bM.RenderRobotsTxt(&buf, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(buf.String(), "get") || !strings.Contains(buf.String(), "GPTBot") {
+			t.Errorf("expected only bots matched by name in robots.txt, got:\n%s", buf.String())
+		}
+	}
+}
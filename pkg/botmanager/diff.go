@@ -0,0 +1,134 @@
+package botmanager
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/parser"
+)
+
+// DiffHook is called with the changes made to the bot index by each refresh that changed it.
+type DiffHook func(d Diff)
+
+// BotChange identifies a bot in a Diff, along with the source it was retrieved from.
+type BotChange struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// Diff describes the changes made to the bot index by a refresh.
+type Diff struct {
+	Added   []BotChange `json:"added"`
+	Removed []BotChange `json:"removed"`
+	// Changed holds bots whose metadata, paths, or source changed
+	Changed []BotChange `json:"changed"`
+}
+
+// Empty checks if the refresh made no changes to the bot index.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// BySource groups the changes by the source each bot was retrieved from.
+func (d Diff) BySource() map[string]Diff {
+	res := make(map[string]Diff)
+	for _, c := range d.Added {
+		sd := res[c.Source]
+		sd.Added = append(sd.Added, c)
+		res[c.Source] = sd
+	}
+	for _, c := range d.Removed {
+		sd := res[c.Source]
+		sd.Removed = append(sd.Removed, c)
+		res[c.Source] = sd
+	}
+	for _, c := range d.Changed {
+		sd := res[c.Source]
+		sd.Changed = append(sd.Changed, c)
+		res[c.Source] = sd
+	}
+	return res
+}
+
+// Names returns the names of the provided bots.
+func Names(changes []BotChange) []string {
+	n := make([]string, 0, len(changes))
+	for _, c := range changes {
+		n = append(n, c.Name)
+	}
+	return n
+}
+
+// diffIndex compares two versions of a bot index, returning the bots added, removed, and changed.
+// Removed bots are attributed to the source they were previously retrieved from.
+func diffIndex(prev parser.RobotsIndex, next parser.RobotsIndex) Diff {
+	d := Diff{Added: []BotChange{}, Removed: []BotChange{}, Changed: []BotChange{}}
+	for name, n := range next {
+		p, ok := prev[name]
+		if !ok {
+			d.Added = append(d.Added, BotChange{Name: name, Source: n.Source})
+		} else if !botEqual(p, n) {
+			d.Changed = append(d.Changed, BotChange{Name: name, Source: n.Source})
+		}
+	}
+	for name, p := range prev {
+		if _, ok := next[name]; !ok {
+			d.Removed = append(d.Removed, BotChange{Name: name, Source: p.Source})
+		}
+	}
+	for _, l := range [][]BotChange{d.Added, d.Removed, d.Changed} {
+		sort.Slice(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	}
+	return d
+}
+
+func botEqual(a parser.BotUserAgent, b parser.BotUserAgent) bool {
+	return a.Source == b.Source && a.JSONMetadata == b.JSONMetadata && a.CrawlDelay == b.CrawlDelay &&
+		slices.Equal(a.DisallowPath, b.DisallowPath) && slices.Equal(a.AllowPath, b.AllowPath) &&
+		patternEqual(a, b) && crawlerEqual(a, b)
+}
+
+// patternEqual reports whether two bots are matched by the same pattern, or both by name.
+func patternEqual(a parser.BotUserAgent, b parser.BotUserAgent) bool {
+	if a.Pattern == nil || b.Pattern == nil {
+		return a.Pattern == nil && b.Pattern == nil
+	}
+	return a.Pattern.String() == b.Pattern.String()
+}
+
+// crawlerEqual reports whether two bots have the same crawler metadata.
+func crawlerEqual(a parser.BotUserAgent, b parser.BotUserAgent) bool {
+	ac, bc := a.CrawlerMetadata, b.CrawlerMetadata
+	return ac.URL == bc.URL && ac.AdditionDate == bc.AdditionDate && slices.Equal(ac.Instances, bc.Instances)
+}
+
+// sourceCounts counts the bots in the index retrieved from each source.
+func sourceCounts(i parser.RobotsIndex) map[string]int {
+	c := make(map[string]int)
+	for _, v := range i {
+		c[v.Source]++
+	}
+	return c
+}
+
+// logDiff logs the changes made to the bot index by a refresh, for each source.
+// A source that lost at least half its bots is logged as a warning, since that usually points to a problem upstream.
+func (b *BotUAManager) logDiff(d Diff, prev parser.RobotsIndex) {
+	prevCounts := sourceCounts(prev)
+	for src, sd := range d.BySource() {
+		args := []any{"source", src, "added", Names(sd.Added), "removed", Names(sd.Removed), "changed", Names(sd.Changed)}
+		if len(sd.Removed) > 0 && len(sd.Removed)*2 >= prevCounts[src] {
+			b.log.Warn("refreshBotIndex: source dropped at least half of its bots", args...)
+			continue
+		}
+		b.log.Info("refreshBotIndex: bot index changed", args...)
+	}
+}
+
+// OnChange registers a hook to be called with the changes made to the bot index by each refresh that changed it.
+// It is not called for the initial load of the index.
+func (b *BotUAManager) OnChange(h DiffHook) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.diffHooks = append(b.diffHooks, h)
+}
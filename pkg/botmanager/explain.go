@@ -0,0 +1,49 @@
+package botmanager
+
+import (
+	"strings"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/parser"
+)
+
+// Match describes how a User-Agent matched an entry in the bot index.
+type Match struct {
+	BotName string
+	// Offsets holds the start and end byte offsets of each occurrence of the bot name, or each match of its pattern, in the User-Agent
+	Offsets [][2]int
+	Info    parser.BotUserAgent
+}
+
+// Explain searches the bot index for the provided User-Agent like Search, but bypasses the cache and reports where the match was found.
+func (b *BotUAManager) Explain(u string) (Match, error) {
+	var m Match
+	if b.cache == nil {
+		return m, errBotManagerNoInit
+	}
+	err := b.refreshBotIndex()
+	if err != nil {
+		return m, err
+	}
+
+	m.BotName = b.search(u)
+	if m.BotName == "" {
+		return m, nil
+	}
+	m.Info = b.botIndex[m.BotName]
+	if m.Info.Pattern != nil {
+		for _, o := range m.Info.Pattern.FindAllStringIndex(u, -1) {
+			m.Offsets = append(m.Offsets, [2]int{o[0], o[1]})
+		}
+		return m, nil
+	}
+	for i := 0; ; {
+		j := strings.Index(u[i:], m.BotName)
+		if j < 0 {
+			break
+		}
+		start := i + j
+		m.Offsets = append(m.Offsets, [2]int{start, start + len(m.BotName)})
+		i = start + len(m.BotName)
+	}
+	return m, nil
+}
@@ -0,0 +1,66 @@
+package botmanager
+
+import (
+	"slices"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/parser"
+)
+
+// mergeIndex adds the bots of a source's index into the merged index, using the source's merge strategy for bots already present.
+//   - OVERRIDE replaces the existing entry.
+//   - KEEP_FIRST keeps the existing entry.
+//   - MERGE fills in the existing entry's metadata with any fields the source provides, and combines their paths.
+func mergeIndex(dst parser.RobotsIndex, src parser.RobotsIndex, strategy string) {
+	for name, v := range src {
+		cur, ok := dst[name]
+		if !ok {
+			dst[name] = v
+			continue
+		}
+		switch strategy {
+		case config.SourceMergeKeepFirst:
+		case config.SourceMergeMetadata:
+			dst[name] = mergeBot(cur, v)
+		default:
+			dst[name] = v
+		}
+	}
+}
+
+// mergeBot combines two entries for the same bot. Non-empty metadata fields and crawl-delay of the newer entry take precedence, while the existing entry's source is kept.
+func mergeBot(cur parser.BotUserAgent, v parser.BotUserAgent) parser.BotUserAgent {
+	m := &cur.JSONMetadata
+	for _, f := range [][2]*string{
+		{&m.Operator, &v.JSONMetadata.Operator},
+		{&m.Respect, &v.JSONMetadata.Respect},
+		{&m.Function, &v.JSONMetadata.Function},
+		{&m.Frequency, &v.JSONMetadata.Frequency},
+		{&m.Description, &v.JSONMetadata.Description},
+	} {
+		if *f[1] != "" {
+			*f[0] = *f[1]
+		}
+	}
+	if v.CrawlDelay > 0 {
+		cur.CrawlDelay = v.CrawlDelay
+	}
+	if cur.Pattern == nil && v.Pattern != nil {
+		cur.Pattern = v.Pattern
+		cur.CrawlerMetadata = v.CrawlerMetadata
+	}
+	cur.AllowPath = mergePaths(cur.AllowPath, v.AllowPath)
+	cur.DisallowPath = mergePaths(cur.DisallowPath, v.DisallowPath)
+	return cur
+}
+
+// mergePaths returns the paths of both lists, without duplicates, in the order they were first seen.
+func mergePaths(a []string, b []string) []string {
+	res := slices.Clone(a)
+	for _, p := range b {
+		if !slices.Contains(res, p) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
@@ -0,0 +1,50 @@
+package botmanager
+
+import (
+	"sort"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/parser"
+)
+
+// literalIndex returns the bots in the index that are matched by name, leaving out those defined by a pattern.
+func literalIndex(i parser.RobotsIndex) parser.RobotsIndex {
+	l := make(parser.RobotsIndex, len(i))
+	for k, v := range i {
+		if v.Pattern == nil {
+			l[k] = v
+		}
+	}
+	return l
+}
+
+// patternNames returns the names of the bots in the index that are defined by a pattern, sorted so they're always tried in the same order.
+func patternNames(i parser.RobotsIndex) []string {
+	var p []string
+	for k, v := range i {
+		if v.Pattern != nil {
+			p = append(p, k)
+		}
+	}
+	sort.Strings(p)
+	return p
+}
+
+// search looks up the bot matching the provided user-agent. Bots matched by name are tried before those defined by a pattern,
+// as a substring search is far cheaper than running every pattern.
+func (b *BotUAManager) search(u string) string {
+	var botName string
+	if b.searchFast {
+		botName = b.fastSearch(u)
+	} else {
+		botName = b.slowSearch(u)
+	}
+	if botName != "" {
+		return botName
+	}
+	for _, name := range b.patterns {
+		if b.botIndex[name].Pattern.MatchString(u) {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package botmanager
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/parser"
+)
+
+// successJitter is the fraction of the update interval that successful refreshes are brought forward by, at most.
+// It spreads out the refreshes of replicas that started at the same time.
+const successJitter = 10
+
+// sourceState tracks the retrieval schedule of a source, along with the last index successfully retrieved from it.
+type sourceState struct {
+	index parser.RobotsIndex
+	// interval overrides the update interval of the BotUAManager for this source
+	interval time.Duration
+	// merge is the strategy used when a bot from this source is already in the index
+	merge  string
+	status SourceStatus
+}
+
+// interval returns how frequently the source should be refreshed.
+func (b *BotUAManager) interval(st *sourceState) time.Duration {
+	if st.interval > 0 {
+		return st.interval
+	}
+	return b.cacheUpdateInterval
+}
+
+// jitter returns a random duration between 0 and d, inclusive.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1)) //nolint:gosec
+}
+
+// retryDelay returns how long to wait before retrying a source after the provided number of consecutive failures.
+// The delay grows exponentially from the retry interval up to the maximum, with full jitter applied.
+func (b *BotUAManager) retryDelay(failures int) time.Duration {
+	backoff := b.sourceRetryInterval
+	for i := 1; i < failures && backoff < b.sourceRetryMaxInterval; i++ {
+		backoff *= 2
+	}
+	if backoff > b.sourceRetryMaxInterval {
+		backoff = b.sourceRetryMaxInterval
+	}
+	return jitter(backoff)
+}
+
+// state returns the tracked state of the source at the provided URL.
+func (b *BotUAManager) state(u string) *sourceState {
+	st, ok := b.sourceStates[u]
+	if !ok {
+		st = &sourceState{status: SourceStatus{URL: u}}
+		b.sourceStates[u] = st
+	}
+	return st
+}
+
+// recordSource records the outcome of retrieving a source during an update, and schedules its next attempt.
+func (b *BotUAManager) recordSource(st *sourceState, i parser.RobotsIndex, err error) {
+	now := time.Now()
+	if err != nil {
+		st.status.ConsecutiveFailures++
+		st.status.LastError = err.Error()
+		st.status.LastErrorTime = now
+		st.status.NextAttempt = now.Add(b.retryDelay(st.status.ConsecutiveFailures))
+		b.log.Warn("refreshBotIndex: source failed to refresh", "source", st.status.URL, "consecutiveFailures",
+			st.status.ConsecutiveFailures, "nextAttempt", st.status.NextAttempt.Format(time.RFC1123), "error", err.Error())
+		return
+	}
+	if st.status.ConsecutiveFailures > 0 {
+		b.log.Info("refreshBotIndex: source recovered", "source", st.status.URL, "consecutiveFailures", st.status.ConsecutiveFailures)
+	}
+	st.index = i
+	st.status.Bots = len(i)
+	st.status.ConsecutiveFailures = 0
+	st.status.LastSuccess = now
+	iDur := b.interval(st)
+	st.status.NextAttempt = now.Add(iDur - jitter(iDur/successJitter))
+}
+
+// nextSourceAttempt returns the earliest time any source is due to be retrieved.
+func (b *BotUAManager) nextSourceAttempt() time.Time {
+	var next time.Time
+	for _, s := range b.sources {
+		a := b.state(s.URL).status.NextAttempt
+		if next.IsZero() || a.Before(next) {
+			next = a
+		}
+	}
+	return next
+}
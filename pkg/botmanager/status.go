@@ -0,0 +1,70 @@
+package botmanager
+
+import (
+	"time"
+)
+
+// Status describes the current state of a BotUAManager's index, sources, and cache.
+type Status struct {
+	IndexSize    int            `json:"indexSize"`
+	LastModified time.Time      `json:"lastModified"`
+	NextUpdate   time.Time      `json:"nextUpdate"`
+	Sources      []SourceStatus `json:"sources"`
+	Cache        CacheStatus    `json:"cache"`
+}
+
+// SourceStatus describes the outcome of the most recent attempts to retrieve a source.
+type SourceStatus struct {
+	URL           string    `json:"url"`
+	Bots          int       `json:"bots"`
+	LastSuccess   time.Time `json:"lastSuccess"`
+	LastError     string    `json:"lastError,omitempty"`
+	LastErrorTime time.Time `json:"lastErrorTime"`
+	// ConsecutiveFailures counts the failed attempts since the source was last retrieved successfully
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	NextAttempt         time.Time `json:"nextAttempt"`
+}
+
+// CacheStatus describes the usage of the User-Agent cache.
+type CacheStatus struct {
+	Size   int `json:"size"`
+	Limit  int `json:"limit"`
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+// recordSearch counts a User-Agent cache hit or miss.
+func (b *BotUAManager) recordSearch(hit bool) {
+	b.statsLock.Lock()
+	defer b.statsLock.Unlock()
+	if hit {
+		b.cacheHits++
+	} else {
+		b.cacheMisses++
+	}
+}
+
+// Status returns the current state of the index, its sources, and the User-Agent cache.
+func (b *BotUAManager) Status() Status {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	s := Status{
+		IndexSize:    len(b.botIndex),
+		LastModified: b.lastModified,
+		NextUpdate:   b.nextUpdate,
+		Sources:      make([]SourceStatus, 0, len(b.sources)),
+	}
+	for _, src := range b.sources {
+		s.Sources = append(s.Sources, b.state(src.URL).status)
+	}
+
+	b.cache.lock.RLock()
+	s.Cache.Size = len(b.cache.data)
+	s.Cache.Limit = b.cache.limit
+	b.cache.lock.RUnlock()
+	b.statsLock.Lock()
+	s.Cache.Hits = b.cacheHits
+	s.Cache.Misses = b.cacheMisses
+	b.statsLock.Unlock()
+	return s
+}
@@ -0,0 +1,130 @@
+package botmanager
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/parser"
+)
+
+// TemplateData is the data provided to the robots.txt template when it is rendered.
+type TemplateData struct {
+	// UserAgentList is the name of every bot in the index, other than those defined by a pattern.
+	UserAgentList []string
+	// Bots is every bot in the index other than those defined by a pattern, along with its metadata, paths, and source.
+	Bots []TemplateBot
+	// Host is the host the robots.txt was requested for. Empty if rendered outside of a request.
+	Host string
+	// Scheme is the scheme the robots.txt was requested with. Empty if rendered outside of a request.
+	Scheme string
+	// Sitemaps is the configured sitemap URLs. Any relative to the site root are resolved against the request's scheme and host.
+	Sitemaps []string
+}
+
+// TemplateBot describes a single bot from the index to the robots.txt template.
+type TemplateBot struct {
+	Name string
+	parser.BotUserAgent
+}
+
+// templateFuncs returns the helper functions available in robots.txt templates.
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"sortAlpha": sortAlpha,
+		"groupBy":   groupBy,
+		"join":      join,
+		"lower":     strings.ToLower,
+	}
+}
+
+// sortAlpha returns a sorted copy of the provided list.
+func sortAlpha(l []string) []string {
+	s := make([]string, len(l))
+	copy(s, l)
+	sort.Strings(s)
+	return s
+}
+
+// join concatenates the list with the provided separator. Arguments are ordered so that the list can be piped in.
+func join(sep string, l []string) string {
+	return strings.Join(l, sep)
+}
+
+// groupBy groups bots by one of their fields: operator, function, respect, frequency, or source.
+// Bots without a value for the field are grouped under an empty string.
+func groupBy(field string, bots []TemplateBot) map[string][]TemplateBot {
+	g := make(map[string][]TemplateBot)
+	for _, b := range bots {
+		var k string
+		// a switch rather than reflection, yaegi is picky about reflecting over struct fields
+		switch strings.ToLower(field) {
+		case "operator":
+			k = b.JSONMetadata.Operator
+		case "function":
+			k = b.JSONMetadata.Function
+		case "respect":
+			k = b.JSONMetadata.Respect
+		case "frequency":
+			k = b.JSONMetadata.Frequency
+		case "source":
+			k = b.Source
+		}
+		g[k] = append(g[k], b)
+	}
+	return g
+}
+
+// requestScheme determines the scheme a request was made with, preferring the value set by Traefik's forwarded headers.
+func requestScheme(r *http.Request) string {
+	if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		return p
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// templateData builds the data for rendering the robots.txt template for the provided request, which may be nil.
+func (b *BotUAManager) templateData(r *http.Request) TemplateData {
+	d := TemplateData{
+		UserAgentList: make([]string, 0, len(b.botIndex)),
+		Bots:          make([]TemplateBot, 0, len(b.botIndex)),
+		Sitemaps:      make([]string, 0, len(b.sitemaps)),
+	}
+	for k, v := range b.botIndex {
+		// a pattern isn't a product token, so crawlers can't be addressed by it in a robots.txt
+		if v.Pattern != nil {
+			continue
+		}
+		d.UserAgentList = append(d.UserAgentList, k)
+		d.Bots = append(d.Bots, TemplateBot{Name: k, BotUserAgent: v})
+	}
+	// the index is a map, so sort to render the same robots.txt every time
+	sort.Strings(d.UserAgentList)
+	sort.Slice(d.Bots, func(i, j int) bool {
+		return d.Bots[i].Name < d.Bots[j].Name
+	})
+
+	if r != nil {
+		d.Host = r.Host
+		d.Scheme = requestScheme(r)
+	}
+	for _, s := range b.sitemaps {
+		if strings.HasPrefix(s, "/") && d.Host != "" {
+			s = d.Scheme + "://" + d.Host + s
+		}
+		d.Sitemaps = append(d.Sitemaps, s)
+	}
+	return d
+}
+
+// templateKey identifies the rendered robots.txt for a request in the template cache.
+func templateKey(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	return requestScheme(r) + "://" + r.Host
+}
@@ -2,11 +2,18 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,13 +23,41 @@ const (
 	BotActionLog   = "LOG"
 	BotActionBlock = "BLOCK"
 	BotActionProxy = "PROXY"
+	BotActionMaze  = "MAZE"
+
+	BotProxyBalancerRoundRobin = "ROUNDROBIN"
+	BotProxyBalancerWeighted   = "WEIGHTED"
 
 	LogLevelDebug = "DEBUG"
 	LogLevelInfo  = "INFO"
 	LogLevelWarn  = "WARN"
 	LogLevelError = "ERROR"
 
+	AuditLogFormatNDJSON   = "NDJSON"
+	AuditLogFormatCombined = "COMBINED"
+
+	LogFormatText = "TEXT"
+	LogFormatJSON = "JSON"
+
+	SourceFormatAuto              = "AUTO"
+	SourceFormatJSON              = "JSON"
+	SourceFormatRobotsTxt         = "ROBOTSTXT"
+	SourceFormatPlaintext         = "PLAINTEXT"
+	SourceFormatCrawlerUserAgents = "CRAWLER_USER_AGENTS"
+	SourceFormatNginx             = "NGINX"
+	SourceFormatApache            = "APACHE"
+
+	SourceMergeOverride  = "OVERRIDE"
+	SourceMergeKeepFirst = "KEEP_FIRST"
+	SourceMergeMetadata  = "MERGE"
+
 	defaultMaxCacheSize = 500
+	defaultMazeLinks    = 8
+	defaultProxyFails   = 3
+	defaultLogMaxSize   = 10
+	defaultLogBackups   = 3
+	defaultNotifyQueue  = 100
+	defaultNotifyTries  = 3
 )
 
 // default robots.txt template that will be rendered.
@@ -32,6 +67,9 @@ const (
 User-agent: {{ $agent }}
 {{- end }}
 Disallow: /
+{{ range $sitemap := .Sitemaps }}
+Sitemap: {{ $sitemap }}
+{{- end }}
 `
 )
 
@@ -43,41 +81,170 @@ Disallow: /
 `
 )
 
+// Profile overrides the robots.txt and bot action for requests to a set of hosts.
+type Profile struct {
+	Hosts             string `json:"hosts,omitempty"`
+	BotAction         string `json:"botAction,omitempty"`
+	RobotsTXTFilePath string `json:"robotsTxtFilePath,omitempty"`
+	RobotsTXTSitemaps string `json:"robotsTxtSitemaps,omitempty"`
+	RobotsSourceURL   string `json:"robotsSourceUrl,omitempty"`
+}
+
+// RobotsSource defines a source of bots, along with how its content is requested, verified, and merged with other sources.
+type RobotsSource struct {
+	URL             string            `json:"url,omitempty"`
+	SHA256          string            `json:"sha256,omitempty"`
+	PublicKey       string            `json:"publicKey,omitempty"`
+	SignatureURL    string            `json:"signatureUrl,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	BearerTokenFile string            `json:"bearerTokenFile,omitempty"`
+	CAFile          string            `json:"caFile,omitempty"`
+	ProxyURL        string            `json:"proxyUrl,omitempty"`
+	ConnectTimeout  string            `json:"connectTimeout,omitempty"`
+	Timeout         string            `json:"timeout,omitempty"`
+	MaxSize         int               `json:"maxSize,omitempty"`
+	Interval        string            `json:"interval,omitempty"`
+	Priority        int               `json:"priority,omitempty"`
+	Merge           string            `json:"merge,omitempty"`
+	Format          string            `json:"format,omitempty"`
+}
+
+// Scope overrides the bot action for requests matching its paths and methods.
+type Scope struct {
+	Paths     string `json:"paths,omitempty"`
+	Methods   string `json:"methods,omitempty"`
+	BotAction string `json:"botAction,omitempty"`
+}
+
 // Config the plugin configuration.
 type Config struct {
-	Enabled                   string `json:"enabled,omitempty"`
-	BotAction                 string `json:"botAction,omitempty"`
-	BotBlockHTTPCode          int    `json:"botBlockHttpCode,omitempty"`
-	BotBlockHTTPResponse      string `json:"botBlockHttpResponse,omitempty"`
-	BotProxyURL               string `json:"botProxyUrl,omitempty"`
-	CacheSize                 int    `json:"cacheSize,omitempty"`
-	CacheUpdateInterval       string `json:"cacheUpdateInterval,omitempty"`
-	LogLevel                  string `json:"logLevel,omitempty"`
-	SetNoArchiveHeader        bool   `json:"setNoArchiveHeader,omitempty"`
-	RobotsTXTFilePath         string `json:"robotsTxtFilePath,omitempty"`
-	RobotsTXTDisallowAll      bool   `json:"robotsTxtDisallowAll,omitempty"`
-	RobotsSourceURL           string `json:"robotsSourceUrl,omitempty"`
-	RobotsSourceRetryInterval string `json:"robotsSourceRetryInterval,omitempty"`
-	UseFastMatch              bool   `json:"useFastMatch,omitempty"`
+	Enabled                       string         `json:"enabled,omitempty"`
+	AdminPath                     string         `json:"adminPath,omitempty"`
+	AdminToken                    string         `json:"adminToken,omitempty"`
+	AdminAllowIPs                 string         `json:"adminAllowIps,omitempty"`
+	AuditLogPath                  string         `json:"auditLogPath,omitempty"`
+	AuditLogFormat                string         `json:"auditLogFormat,omitempty"`
+	BotAction                     string         `json:"botAction,omitempty"`
+	BotBlockHTTPCode              int            `json:"botBlockHttpCode,omitempty"`
+	BotBlockHTTPResponse          string         `json:"botBlockHttpResponse,omitempty"`
+	BotProxyURL                   string         `json:"botProxyUrl,omitempty"`
+	BotProxyBalancer              string         `json:"botProxyBalancer,omitempty"`
+	BotProxyWeights               string         `json:"botProxyWeights,omitempty"`
+	BotProxyHealthCheckPath       string         `json:"botProxyHealthCheckPath,omitempty"`
+	BotProxyHealthCheckInterval   string         `json:"botProxyHealthCheckInterval,omitempty"`
+	BotProxyHealthCheckTimeout    string         `json:"botProxyHealthCheckTimeout,omitempty"`
+	BotProxyMaxFails              int            `json:"botProxyMaxFails,omitempty"`
+	BotProxyFailTimeout           string         `json:"botProxyFailTimeout,omitempty"`
+	BotProxyStripHeaders          string         `json:"botProxyStripHeaders,omitempty"`
+	BotProxyHost                  string         `json:"botProxyHost,omitempty"`
+	BotProxyPreserveHost          bool           `json:"botProxyPreserveHost,omitempty"`
+	BotProxyBotHeaders            bool           `json:"botProxyBotHeaders,omitempty"`
+	BotProxyDialTimeout           string         `json:"botProxyDialTimeout,omitempty"`
+	BotProxyResponseHeaderTimeout string         `json:"botProxyResponseHeaderTimeout,omitempty"`
+	BotProxyTimeout               string         `json:"botProxyTimeout,omitempty"`
+	BotProxyInsecureSkipVerify    bool           `json:"botProxyInsecureSkipVerify,omitempty"`
+	BotMazePathPrefix             string         `json:"botMazePathPrefix,omitempty"`
+	BotMazeLinkCount              int            `json:"botMazeLinkCount,omitempty"`
+	CacheSize                     int            `json:"cacheSize,omitempty"`
+	CacheUpdateInterval           string         `json:"cacheUpdateInterval,omitempty"`
+	CrawlDelayEnforce             bool           `json:"crawlDelayEnforce,omitempty"`
+	ExcludePaths                  string         `json:"excludePaths,omitempty"`
+	IncludePaths                  string         `json:"includePaths,omitempty"`
+	LogLevel                      string         `json:"logLevel,omitempty"`
+	LogFormat                     string         `json:"logFormat,omitempty"`
+	LogDestination                string         `json:"logDestination,omitempty"`
+	LogMaxSize                    int            `json:"logMaxSize,omitempty"`
+	LogMaxBackups                 int            `json:"logMaxBackups,omitempty"`
+	LogDedupWindow                string         `json:"logDedupWindow,omitempty"`
+	NotifyWebhookURLs             string         `json:"notifyWebhookUrls,omitempty"`
+	NotifySecret                  string         `json:"notifySecret,omitempty"`
+	NotifyThreshold               int            `json:"notifyThreshold,omitempty"`
+	NotifyThresholdWindow         string         `json:"notifyThresholdWindow,omitempty"`
+	NotifyQueueSize               int            `json:"notifyQueueSize,omitempty"`
+	NotifyRetries                 int            `json:"notifyRetries,omitempty"`
+	NotifyRetryBackoff            string         `json:"notifyRetryBackoff,omitempty"`
+	Methods                       string         `json:"methods,omitempty"`
+	Profiles                      []Profile      `json:"profiles,omitempty"`
+	SetNoArchiveHeader            bool           `json:"setNoArchiveHeader,omitempty"`
+	ShadowMode                    bool           `json:"shadowMode,omitempty"`
+	ShadowLiveAction              string         `json:"shadowLiveAction,omitempty"`
+	RobotsTXTFilePath             string         `json:"robotsTxtFilePath,omitempty"`
+	RobotsTXTDisallowAll          bool           `json:"robotsTxtDisallowAll,omitempty"`
+	RobotsTXTMergeUpstream        bool           `json:"robotsTxtMergeUpstream,omitempty"`
+	RobotsTXTMergeCacheTTL        string         `json:"robotsTxtMergeCacheTtl,omitempty"`
+	RobotsTXTSitemaps             string         `json:"robotsTxtSitemaps,omitempty"`
+	RobotsSourceURL               string         `json:"robotsSourceUrl,omitempty"`
+	RobotsSources                 []RobotsSource `json:"robotsSources,omitempty"`
+	RobotsSourceRetryInterval     string         `json:"robotsSourceRetryInterval,omitempty"`
+	RobotsSourceRetryMaxInterval  string         `json:"robotsSourceRetryMaxInterval,omitempty"`
+	Scopes                        []Scope        `json:"scopes,omitempty"`
+	UseFastMatch                  bool           `json:"useFastMatch,omitempty"`
 }
 
 // New creates the default plugin configuration.
 func New() *Config {
 	return &Config{
-		Enabled:                   "true",
-		BotAction:                 "LOG",
-		BotBlockHTTPCode:          http.StatusForbidden,
-		BotBlockHTTPResponse:      "Your user agent is associated with a large language model (LLM) and is blocked from accessing this resource",
-		BotProxyURL:               "",
-		CacheSize:                 defaultMaxCacheSize,
-		CacheUpdateInterval:       "24h",
-		LogLevel:                  "INFO",
-		SetNoArchiveHeader:        true,
-		RobotsTXTFilePath:         "",
-		RobotsTXTDisallowAll:      false,
-		RobotsSourceURL:           "https://cdn.jsdelivr.net/gh/ai-robots-txt/ai.robots.txt@v1.42/robots.json",
-		RobotsSourceRetryInterval: "5m",
-		UseFastMatch:              true,
+		Enabled:                       "true",
+		AdminPath:                     "",
+		AdminToken:                    "",
+		AdminAllowIPs:                 "",
+		AuditLogPath:                  "",
+		AuditLogFormat:                AuditLogFormatNDJSON,
+		BotAction:                     "LOG",
+		BotBlockHTTPCode:              http.StatusForbidden,
+		BotBlockHTTPResponse:          "Your user agent is associated with a large language model (LLM) and is blocked from accessing this resource",
+		BotProxyURL:                   "",
+		BotProxyBalancer:              BotProxyBalancerRoundRobin,
+		BotProxyWeights:               "",
+		BotProxyHealthCheckPath:       "/",
+		BotProxyHealthCheckInterval:   "30s",
+		BotProxyHealthCheckTimeout:    "5s",
+		BotProxyMaxFails:              defaultProxyFails,
+		BotProxyFailTimeout:           "30s",
+		BotProxyStripHeaders:          "Cookie,Authorization",
+		BotProxyHost:                  "",
+		BotProxyPreserveHost:          true,
+		BotProxyBotHeaders:            true,
+		BotProxyDialTimeout:           "5s",
+		BotProxyResponseHeaderTimeout: "30s",
+		BotProxyTimeout:               "0s",
+		BotProxyInsecureSkipVerify:    false,
+		BotMazePathPrefix:             "/maze/",
+		BotMazeLinkCount:              defaultMazeLinks,
+		CacheSize:                     defaultMaxCacheSize,
+		CacheUpdateInterval:           "24h",
+		CrawlDelayEnforce:             false,
+		ExcludePaths:                  "",
+		IncludePaths:                  "",
+		LogLevel:                      "INFO",
+		LogFormat:                     LogFormatText,
+		LogDestination:                "stdout",
+		LogMaxSize:                    defaultLogMaxSize,
+		LogMaxBackups:                 defaultLogBackups,
+		LogDedupWindow:                "0s",
+		NotifyWebhookURLs:             "",
+		NotifySecret:                  "",
+		NotifyThreshold:               0,
+		NotifyThresholdWindow:         "1m",
+		NotifyQueueSize:               defaultNotifyQueue,
+		NotifyRetries:                 defaultNotifyTries,
+		NotifyRetryBackoff:            "1s",
+		Methods:                       "",
+		Profiles:                      []Profile{},
+		SetNoArchiveHeader:            true,
+		ShadowMode:                    false,
+		ShadowLiveAction:              BotActionLog,
+		RobotsTXTFilePath:             "",
+		RobotsTXTDisallowAll:          false,
+		RobotsTXTMergeUpstream:        false,
+		RobotsTXTMergeCacheTTL:        "5m",
+		RobotsTXTSitemaps:             "",
+		RobotsSourceURL:               "https://cdn.jsdelivr.net/gh/ai-robots-txt/ai.robots.txt@v1.42/robots.json",
+		RobotsSources:                 []RobotsSource{},
+		RobotsSourceRetryInterval:     "5m",
+		RobotsSourceRetryMaxInterval:  "1h",
+		Scopes:                        []Scope{},
+		UseFastMatch:                  true,
 	}
 }
 
@@ -92,9 +259,20 @@ func (c *Config) ValidateConfig() error {
 	if !slices.Contains([]string{LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError}, c.LogLevel) {
 		return fmt.Errorf("ValidateConfig: LogLevel must be one of '%s', '%s', '%s', '%s'. Got '%s'", LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError, c.LogLevel)
 	}
+	// LogFormat, LogDestination, LogMaxSize, LogMaxBackups, LogDedupWindow, AuditLogFormat
+	err = c.validateLogOutput()
+	if err != nil {
+		return err
+	}
 	// BotAction
-	if !slices.Contains([]string{BotActionPass, BotActionLog, BotActionBlock, BotActionProxy}, c.BotAction) {
-		return fmt.Errorf("ValidateConfig: BotAction must be one of '%s', '%s', '%s', '%s'. Got '%s'", BotActionPass, BotActionLog, BotActionBlock, BotActionProxy, c.BotAction)
+	err = validateBotAction("BotAction", c.BotAction)
+	if err != nil {
+		return err
+	}
+	// ShadowLiveAction
+	err = validateBotAction("ShadowLiveAction", c.ShadowLiveAction)
+	if err != nil {
+		return err
 	}
 	// BotBlockHttpCode
 	if http.StatusText(c.BotBlockHTTPCode) == "" {
@@ -102,18 +280,29 @@ func (c *Config) ValidateConfig() error {
 	}
 	// BotBlockHttpResponse
 	// no validation. We'll allow any string to be specified here.
-	// BotProxyURL
-	if c.BotProxyURL != "" {
-		_, err = url.ParseRequestURI(c.BotProxyURL)
-		if err != nil {
-			return fmt.Errorf("ValidateConfig: BotProxyURL must be a valid URL. Got '%s'", c.BotProxyURL)
-		}
+	// BotProxyURL and associated settings
+	err = c.validateBotProxy()
+	if err != nil {
+		return err
+	}
+	// BotMazePathPrefix
+	if !strings.HasPrefix(c.BotMazePathPrefix, "/") || c.BotMazePathPrefix == "/" {
+		return fmt.Errorf("ValidateConfig: BotMazePathPrefix must be an absolute path other than '/'. Got '%s'", c.BotMazePathPrefix)
+	}
+	// BotMazeLinkCount
+	if c.BotMazeLinkCount <= 0 {
+		return fmt.Errorf("ValidateConfig: BotMazeLinkCount must be a positive integer. Got '%d'", c.BotMazeLinkCount)
 	}
 	// RobotsSourceURL
 	_, err = url.ParseRequestURI(c.RobotsSourceURL)
 	if err != nil {
 		return fmt.Errorf("ValidateConfig: RobotsSourceURL must be a valid URL. Got '%s'", c.RobotsSourceURL)
 	}
+	// RobotsSources
+	err = c.validateSources()
+	if err != nil {
+		return err
+	}
 	// CacheUpdateInterval
 	_, err = time.ParseDuration(c.CacheUpdateInterval)
 	if err != nil {
@@ -130,6 +319,382 @@ func (c *Config) ValidateConfig() error {
 	if err != nil {
 		return fmt.Errorf("ValidateConfig: RobotsSourceRetryInterval must be a time duration string. Got '%s'", c.RobotsSourceRetryInterval)
 	}
+	// RobotsSourceRetryMaxInterval
+	_, err = time.ParseDuration(c.RobotsSourceRetryMaxInterval)
+	if err != nil {
+		return fmt.Errorf("ValidateConfig: RobotsSourceRetryMaxInterval must be a time duration string. Got '%s'", c.RobotsSourceRetryMaxInterval)
+	}
+	// RobotsTXTMergeCacheTTL
+	_, err = time.ParseDuration(c.RobotsTXTMergeCacheTTL)
+	if err != nil {
+		return fmt.Errorf("ValidateConfig: RobotsTXTMergeCacheTTL must be a time duration string. Got '%s'", c.RobotsTXTMergeCacheTTL)
+	}
+	// AdminPath, AdminToken, and AdminAllowIPs
+	err = c.validateAdmin()
+	if err != nil {
+		return err
+	}
+	// NotifyWebhookURLs and associated settings
+	err = c.validateNotify()
+	if err != nil {
+		return err
+	}
+	// ExcludePaths, IncludePaths, Methods, and Scopes
+	err = c.validateScopes()
+	if err != nil {
+		return err
+	}
+	// Profiles
+	return c.validateProfiles()
+}
 
+// UsesAction checks if the provided bot action is used anywhere in the configuration, including scopes and profiles.
+func (c *Config) UsesAction(a string) bool {
+	if c.BotAction == a || (c.ShadowMode && c.ShadowLiveAction == a) {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if strings.ToUpper(s.BotAction) == a {
+			return true
+		}
+	}
+	for _, p := range c.Profiles {
+		if strings.ToUpper(p.BotAction) == a {
+			return true
+		}
+	}
+	return false
+}
+
+// validateLogOutput validates the settings for the format and destination of the plugin's logs, and its audit log.
+func (c *Config) validateLogOutput() error {
+	if !slices.Contains([]string{LogFormatText, LogFormatJSON}, strings.ToUpper(c.LogFormat)) {
+		return fmt.Errorf("ValidateConfig: LogFormat must be one of '%s', '%s'. Got '%s'", LogFormatText, LogFormatJSON, c.LogFormat)
+	}
+	if c.LogDestination == "" {
+		return errors.New("ValidateConfig: LogDestination must be 'stdout', 'stderr', or a file path")
+	}
+	if c.LogMaxSize <= 0 {
+		return fmt.Errorf("ValidateConfig: LogMaxSize must be a positive integer. Got '%d'", c.LogMaxSize)
+	}
+	if c.LogMaxBackups < 0 {
+		return fmt.Errorf("ValidateConfig: LogMaxBackups must not be negative. Got '%d'", c.LogMaxBackups)
+	}
+	d, err := time.ParseDuration(c.LogDedupWindow)
+	if err != nil || d < 0 {
+		return fmt.Errorf("ValidateConfig: LogDedupWindow must be a non-negative time duration string. Got '%s'", c.LogDedupWindow)
+	}
+	if !slices.Contains([]string{AuditLogFormatNDJSON, AuditLogFormatCombined}, strings.ToUpper(c.AuditLogFormat)) {
+		return fmt.Errorf("ValidateConfig: AuditLogFormat must be one of '%s', '%s'. Got '%s'", AuditLogFormatNDJSON, AuditLogFormatCombined, c.AuditLogFormat)
+	}
+	return nil
+}
+
+// SourceFormats returns the formats a structured source may declare.
+func SourceFormats() []string {
+	return []string{SourceFormatAuto, SourceFormatJSON, SourceFormatRobotsTxt, SourceFormatPlaintext, SourceFormatCrawlerUserAgents, SourceFormatNginx, SourceFormatApache}
+}
+
+// SourceList returns the sources to retrieve bots from. RobotsSources takes precedence over RobotsSourceURL when set.
+func (c *Config) SourceList() []RobotsSource {
+	if len(c.RobotsSources) > 0 {
+		return c.RobotsSources
+	}
+	var sources []RobotsSource
+	for _, u := range strings.Split(c.RobotsSourceURL, ",") {
+		sources = append(sources, RobotsSource{URL: u})
+	}
+	return sources
+}
+
+// validateSources validates the URL and integrity options of each structured source.
+func (c *Config) validateSources() error {
+	for i, s := range c.RobotsSources {
+		err := validateSource(i, s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSource validates the URL, integrity, and HTTP client options of a structured source.
+func validateSource(i int, s RobotsSource) error {
+	_, err := url.ParseRequestURI(s.URL)
+	if err != nil {
+		return fmt.Errorf("ValidateConfig: RobotsSources[%d] URL must be a valid URL. Got '%s'", i, s.URL)
+	}
+	err = validateSourceIntegrity(i, s)
+	if err != nil {
+		return err
+	}
+	if s.ProxyURL != "" {
+		_, err = url.ParseRequestURI(s.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("ValidateConfig: RobotsSources[%d] ProxyURL must be a valid URL. Got '%s'", i, s.ProxyURL)
+		}
+	}
+	for n, d := range map[string]string{"ConnectTimeout": s.ConnectTimeout, "Timeout": s.Timeout} {
+		if d == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("ValidateConfig: RobotsSources[%d] %s must be a positive time duration string. Got '%s'", i, n, d)
+		}
+	}
+	if s.MaxSize < 0 {
+		return fmt.Errorf("ValidateConfig: RobotsSources[%d] MaxSize must not be negative. Got '%d'", i, s.MaxSize)
+	}
+	return validateSourceContent(i, s)
+}
+
+// validateSourceContent validates the declared format, refresh interval, and merge strategy of a structured source.
+func validateSourceContent(i int, s RobotsSource) error {
+	if s.Format != "" && !slices.Contains(SourceFormats(), strings.ToUpper(s.Format)) {
+		return fmt.Errorf("ValidateConfig: RobotsSources[%d] Format must be one of '%s'. Got '%s'", i, strings.Join(SourceFormats(), "', '"), s.Format)
+	}
+	if s.Interval != "" {
+		v, err := time.ParseDuration(s.Interval)
+		if err != nil || v <= 0 {
+			return fmt.Errorf("ValidateConfig: RobotsSources[%d] Interval must be a positive time duration string. Got '%s'", i, s.Interval)
+		}
+	}
+	if s.Merge != "" && !slices.Contains([]string{SourceMergeOverride, SourceMergeKeepFirst, SourceMergeMetadata}, strings.ToUpper(s.Merge)) {
+		return fmt.Errorf("ValidateConfig: RobotsSources[%d] Merge must be one of '%s', '%s', '%s'. Got '%s'", i, SourceMergeOverride, SourceMergeKeepFirst, SourceMergeMetadata, s.Merge)
+	}
+	return nil
+}
+
+// validateSourceIntegrity validates the checksum and signature options of a structured source.
+func validateSourceIntegrity(i int, s RobotsSource) error {
+	if s.SHA256 != "" {
+		sum, err := hex.DecodeString(s.SHA256)
+		if err != nil || len(sum) != sha256.Size {
+			return fmt.Errorf("ValidateConfig: RobotsSources[%d] SHA256 must be a hex encoded SHA-256 checksum. Got '%s'", i, s.SHA256)
+		}
+	}
+	if s.PublicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(s.PublicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("ValidateConfig: RobotsSources[%d] PublicKey must be a base64 encoded ed25519 public key. Got '%s'", i, s.PublicKey)
+		}
+	}
+	if s.SignatureURL != "" {
+		if s.PublicKey == "" {
+			return fmt.Errorf("ValidateConfig: RobotsSources[%d] SignatureURL requires a PublicKey to verify against", i)
+		}
+		_, err := url.ParseRequestURI(s.SignatureURL)
+		if err != nil {
+			return fmt.Errorf("ValidateConfig: RobotsSources[%d] SignatureURL must be a valid URL. Got '%s'", i, s.SignatureURL)
+		}
+	}
+	return nil
+}
+
+// validateAdmin validates the settings for the admin endpoints, which must be protected by a token or an IP allowlist when enabled.
+func (c *Config) validateAdmin() error {
+	if c.AdminPath == "" {
+		return nil
+	}
+	if !strings.HasPrefix(c.AdminPath, "/") || strings.HasSuffix(c.AdminPath, "/") {
+		return fmt.Errorf("ValidateConfig: AdminPath must begin with '/' and not end with '/'. Got '%s'", c.AdminPath)
+	}
+	if c.AdminToken == "" && c.AdminAllowIPs == "" {
+		return errors.New("ValidateConfig: AdminToken or AdminAllowIPs must be set when AdminPath is set")
+	}
+	_, err := ParseIPNets(c.AdminAllowIPs)
+	if err != nil {
+		return fmt.Errorf("ValidateConfig: AdminAllowIPs must be a comma separated list of IP addresses or CIDR ranges. Got '%s'", c.AdminAllowIPs)
+	}
+	return nil
+}
+
+// ParseIPNets parses a comma separated list of IP addresses and CIDR ranges. A bare IP address is treated as a single host range.
+func ParseIPNets(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	if list == "" {
+		return nets, nil
+	}
+	for _, e := range strings.Split(list, ",") {
+		e = strings.TrimSpace(e)
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address '%s'", e)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// validateNotify validates the settings for delivering events to webhooks.
+func (c *Config) validateNotify() error {
+	if c.NotifyWebhookURLs == "" {
+		return nil
+	}
+	for _, u := range strings.Split(c.NotifyWebhookURLs, ",") {
+		_, err := url.ParseRequestURI(strings.TrimSpace(u))
+		if err != nil {
+			return fmt.Errorf("ValidateConfig: NotifyWebhookURLs must be a comma separated list of valid URLs. Got '%s'", c.NotifyWebhookURLs)
+		}
+	}
+	if c.NotifyThreshold < 0 {
+		return fmt.Errorf("ValidateConfig: NotifyThreshold must not be negative. Got '%d'", c.NotifyThreshold)
+	}
+	if c.NotifyQueueSize <= 0 {
+		return fmt.Errorf("ValidateConfig: NotifyQueueSize must be a positive integer. Got '%d'", c.NotifyQueueSize)
+	}
+	if c.NotifyRetries < 0 {
+		return fmt.Errorf("ValidateConfig: NotifyRetries must not be negative. Got '%d'", c.NotifyRetries)
+	}
+	for n, d := range map[string]string{
+		"NotifyThresholdWindow": c.NotifyThresholdWindow,
+		"NotifyRetryBackoff":    c.NotifyRetryBackoff,
+	} {
+		_, err := time.ParseDuration(d)
+		if err != nil {
+			return fmt.Errorf("ValidateConfig: %s must be a time duration string. Got '%s'", n, d)
+		}
+	}
+	return nil
+}
+
+// validateBotAction checks that the named setting is a supported bot action.
+func validateBotAction(name string, a string) error {
+	if !slices.Contains([]string{BotActionPass, BotActionLog, BotActionBlock, BotActionProxy, BotActionMaze}, a) {
+		return fmt.Errorf("ValidateConfig: %s must be one of '%s', '%s', '%s', '%s', '%s'. Got '%s'", name, BotActionPass, BotActionLog, BotActionBlock, BotActionProxy, BotActionMaze, a)
+	}
+	return nil
+}
+
+// validatePaths checks that the named setting is a comma separated list of absolute path globs.
+func validatePaths(name string, paths string) error {
+	if paths == "" {
+		return nil
+	}
+	for _, p := range strings.Split(paths, ",") {
+		if !strings.HasPrefix(strings.TrimSpace(p), "/") {
+			return fmt.Errorf("ValidateConfig: %s must be a comma separated list of absolute paths. Got '%s'", name, paths)
+		}
+	}
+	return nil
+}
+
+// validateScopes validates the settings limiting which requests bot actions are applied to.
+func (c *Config) validateScopes() error {
+	err := validatePaths("ExcludePaths", c.ExcludePaths)
+	if err != nil {
+		return err
+	}
+	err = validatePaths("IncludePaths", c.IncludePaths)
+	if err != nil {
+		return err
+	}
+	for i, s := range c.Scopes {
+		if s.Paths == "" && s.Methods == "" {
+			return fmt.Errorf("ValidateConfig: Scopes[%d] must specify Paths, Methods, or both", i)
+		}
+		err = validatePaths(fmt.Sprintf("Scopes[%d].Paths", i), s.Paths)
+		if err != nil {
+			return err
+		}
+		err = validateBotAction(fmt.Sprintf("Scopes[%d].BotAction", i), strings.ToUpper(s.BotAction))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateProfiles validates each host profile by validating the configuration it results in.
+func (c *Config) validateProfiles() error {
+	for i, p := range c.Profiles {
+		if strings.TrimSpace(p.Hosts) == "" {
+			return fmt.Errorf("ValidateConfig: Profiles[%d] must specify one or more Hosts", i)
+		}
+		err := c.ProfileConfig(p).ValidateConfig()
+		if err != nil {
+			return fmt.Errorf("ValidateConfig: Profiles[%d] is invalid. %w", i, err)
+		}
+	}
+	return nil
+}
+
+// ProfileConfig returns a copy of the configuration, with the settings of the provided profile applied.
+func (c *Config) ProfileConfig(p Profile) *Config {
+	pc := *c
+	pc.Profiles = nil
+	if p.BotAction != "" {
+		pc.BotAction = strings.ToUpper(p.BotAction)
+	}
+	if p.RobotsTXTFilePath != "" {
+		pc.RobotsTXTFilePath = p.RobotsTXTFilePath
+	}
+	if p.RobotsTXTSitemaps != "" {
+		pc.RobotsTXTSitemaps = p.RobotsTXTSitemaps
+	}
+	if p.RobotsSourceURL != "" {
+		pc.RobotsSourceURL = p.RobotsSourceURL
+		pc.RobotsSources = nil
+	}
+	return &pc
+}
+
+// validateBotProxy validates the settings for proxying bot requests to one or more backends.
+func (c *Config) validateBotProxy() error {
+	if c.BotProxyURL == "" {
+		return nil
+	}
+	uL := strings.Split(c.BotProxyURL, ",")
+	for _, u := range uL {
+		_, err := url.ParseRequestURI(strings.TrimSpace(u))
+		if err != nil {
+			return fmt.Errorf("ValidateConfig: BotProxyURL must be a comma separated list of valid URLs. Got '%s'", c.BotProxyURL)
+		}
+	}
+	if !slices.Contains([]string{BotProxyBalancerRoundRobin, BotProxyBalancerWeighted}, c.BotProxyBalancer) {
+		return fmt.Errorf("ValidateConfig: BotProxyBalancer must be one of '%s', '%s'. Got '%s'", BotProxyBalancerRoundRobin, BotProxyBalancerWeighted, c.BotProxyBalancer)
+	}
+	if c.BotProxyWeights != "" {
+		wL := strings.Split(c.BotProxyWeights, ",")
+		if len(wL) != len(uL) {
+			return fmt.Errorf("ValidateConfig: BotProxyWeights must have one weight per BotProxyURL. Got %d weights for %d URLs", len(wL), len(uL))
+		}
+		for _, w := range wL {
+			i, err := strconv.Atoi(strings.TrimSpace(w))
+			if err != nil || i <= 0 {
+				return fmt.Errorf("ValidateConfig: BotProxyWeights must be a comma separated list of positive integers. Got '%s'", c.BotProxyWeights)
+			}
+		}
+	}
+	for n, d := range map[string]string{
+		"BotProxyHealthCheckInterval":   c.BotProxyHealthCheckInterval,
+		"BotProxyHealthCheckTimeout":    c.BotProxyHealthCheckTimeout,
+		"BotProxyFailTimeout":           c.BotProxyFailTimeout,
+		"BotProxyDialTimeout":           c.BotProxyDialTimeout,
+		"BotProxyResponseHeaderTimeout": c.BotProxyResponseHeaderTimeout,
+		"BotProxyTimeout":               c.BotProxyTimeout,
+	} {
+		_, err := time.ParseDuration(d)
+		if err != nil {
+			return fmt.Errorf("ValidateConfig: %s must be a time duration string. Got '%s'", n, d)
+		}
+	}
+	if c.BotProxyMaxFails <= 0 {
+		return fmt.Errorf("ValidateConfig: BotProxyMaxFails must be a positive integer. Got '%d'", c.BotProxyMaxFails)
+	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -118,3 +119,203 @@ func TestConfigBadSourceRetryInterval(t *testing.T) {
 		t.Error("ValidateConfig didn't fail an invalid RobotsSourceRetryInterval.")
 	}
 }
+
+// TestConfigBadBotMazePathPrefix overrides a default config with an invalid BotMazePathPrefix and checks that an error is raised by ValidateConfig().
+func TestConfigBadBotMazePathPrefix(t *testing.T) {
+	for _, p := range []string{"", "/", "maze/"} {
+		c := New()
+		c.BotMazePathPrefix = p
+		err := c.ValidateConfig()
+		if err == nil {
+			t.Errorf("ValidateConfig didn't fail an invalid BotMazePathPrefix '%s'.", p)
+		}
+	}
+}
+
+// TestConfigBadBotMazeLinkCount overrides a default config with an invalid BotMazeLinkCount and checks that an error is raised by ValidateConfig().
+func TestConfigBadBotMazeLinkCount(t *testing.T) {
+	c := New()
+	c.BotMazeLinkCount = 0
+	err := c.ValidateConfig()
+	if err == nil {
+		t.Error("ValidateConfig didn't fail an invalid BotMazeLinkCount.")
+	}
+}
+
+// TestConfigBotProxyMultiple checks that multiple weighted BotProxyURLs are considered valid by ValidateConfig().
+func TestConfigBotProxyMultiple(t *testing.T) {
+	c := New()
+	c.BotProxyURL = "http://tarpit-a:8080,http://tarpit-b:8080"
+	c.BotProxyBalancer = BotProxyBalancerWeighted
+	c.BotProxyWeights = "3,1"
+	err := c.ValidateConfig()
+	if err != nil {
+		t.Error("ValidateConfig did not pass multiple weighted BotProxyURLs. " + err.Error())
+	}
+}
+
+// TestConfigBadBotProxySettings overrides a default config with invalid bot proxy settings and checks that an error is raised by ValidateConfig().
+func TestConfigBadBotProxySettings(t *testing.T) {
+	scenarios := map[string]func(c *Config){
+		"balancer":         func(c *Config) { c.BotProxyBalancer = "RANDOM" },
+		"weightCount":      func(c *Config) { c.BotProxyWeights = "1,2,3" },
+		"weightValue":      func(c *Config) { c.BotProxyWeights = "1,-2" },
+		"healthInterval":   func(c *Config) { c.BotProxyHealthCheckInterval = "often" },
+		"healthTimeout":    func(c *Config) { c.BotProxyHealthCheckTimeout = "soon" },
+		"failTimeout":      func(c *Config) { c.BotProxyFailTimeout = "later" },
+		"maxFails":         func(c *Config) { c.BotProxyMaxFails = 0 },
+		"dialTimeout":      func(c *Config) { c.BotProxyDialTimeout = "quick" },
+		"headerTimeout":    func(c *Config) { c.BotProxyResponseHeaderTimeout = "slow" },
+		"timeout":          func(c *Config) { c.BotProxyTimeout = "never" },
+		"secondInvalidURL": func(c *Config) { c.BotProxyURL = "http://tarpit-a:8080,this is not a URL" },
+	}
+	for name, modify := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			c := New()
+			c.BotProxyURL = "http://tarpit-a:8080,http://tarpit-b:8080"
+			modify(c)
+			err := c.ValidateConfig()
+			if err == nil {
+				t.Error("ValidateConfig didn't fail invalid bot proxy settings.")
+			}
+		})
+	}
+}
+
+// TestConfigBadRobotsTXTMergeCacheTTL overrides a default config with an invalid RobotsTXTMergeCacheTTL and checks that an error is raised by ValidateConfig().
+func TestConfigBadRobotsTXTMergeCacheTTL(t *testing.T) {
+	c := New()
+	c.RobotsTXTMergeCacheTTL = "a while"
+	err := c.ValidateConfig()
+	if err == nil {
+		t.Error("ValidateConfig didn't fail an invalid RobotsTXTMergeCacheTTL.")
+	}
+}
+
+// TestConfigProfiles checks that host profiles are validated as the configuration they result in, and that their settings override the defaults.
+func TestConfigProfiles(t *testing.T) {
+	c := New()
+	c.Profiles = []Profile{{Hosts: "example.com,*.example.com", BotAction: "block", RobotsSourceURL: "https://example.com/robots.txt"}}
+	err := c.ValidateConfig()
+	if err != nil {
+		t.Error("ValidateConfig() did not pass a valid host profile. " + err.Error())
+	}
+	pc := c.ProfileConfig(c.Profiles[0])
+	if pc.BotAction != BotActionBlock || pc.RobotsSourceURL != "https://example.com/robots.txt" || pc.CacheSize != c.CacheSize || len(pc.Profiles) != 0 {
+		t.Errorf("ProfileConfig() did not apply the profile's settings over the defaults. Got %+v", pc)
+	}
+
+	for name, p := range map[string]Profile{
+		"noHosts":   {BotAction: BotActionBlock},
+		"badAction": {Hosts: "example.com", BotAction: "Do a Flip"},
+	} {
+		c.Profiles = []Profile{p}
+		err = c.ValidateConfig()
+		if err == nil {
+			t.Errorf("ValidateConfig didn't fail an invalid host profile: %s", name)
+		}
+	}
+}
+
+// TestConfigBadLogOutput overrides a default config with invalid log output settings and checks that an error is raised by ValidateConfig().
+func TestConfigBadLogOutput(t *testing.T) {
+	for name, f := range map[string]func(c *Config){
+		"format":      func(c *Config) { c.LogFormat = "XML" },
+		"destination": func(c *Config) { c.LogDestination = "" },
+		"maxSize":     func(c *Config) { c.LogMaxSize = 0 },
+		"maxBackups":  func(c *Config) { c.LogMaxBackups = -1 },
+	} {
+		c := New()
+		f(c)
+		err := c.ValidateConfig()
+		if err == nil {
+			t.Errorf("ValidateConfig didn't fail an invalid log output setting: %s", name)
+		}
+	}
+}
+
+// TestConfigAdmin tests that the admin endpoints must be protected when enabled
+func TestConfigAdmin(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		allowIPs string
+		valid    bool
+	}{
+		{name: "Disabled", valid: true},
+		{name: "Unprotected", path: "/admin"},
+		{name: "Token", path: "/admin", token: "secret", valid: true},
+		{name: "AllowIPs", path: "/admin", allowIPs: "10.0.0.0/8, 127.0.0.1, ::1", valid: true},
+		{name: "BadAllowIPs", path: "/admin", allowIPs: "10.0.0.0/99"},
+		{name: "RelativePath", path: "admin", token: "secret"},
+		{name: "TrailingSlash", path: "/admin/", token: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			c.AdminPath = tt.path
+			c.AdminToken = tt.token
+			c.AdminAllowIPs = tt.allowIPs
+			err := c.ValidateConfig()
+			if tt.valid && err != nil {
+				t.Errorf("expected valid configuration, got %s", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected invalid configuration")
+			}
+		})
+	}
+}
+
+// TestConfigRobotsSources tests validation of structured sources, and that they take precedence over RobotsSourceURL
+func TestConfigRobotsSources(t *testing.T) {
+	key := "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+	tests := []struct {
+		name   string
+		source RobotsSource
+		valid  bool
+	}{
+		{name: "URL", source: RobotsSource{URL: "https://example.com/robots.json"}, valid: true},
+		{name: "BadURL", source: RobotsSource{URL: "example"}},
+		{name: "Checksum", source: RobotsSource{URL: "https://example.com/robots.json", SHA256: strings.Repeat("ab", 32)}, valid: true},
+		{name: "BadChecksum", source: RobotsSource{URL: "https://example.com/robots.json", SHA256: "abc"}},
+		{name: "PublicKey", source: RobotsSource{URL: "https://example.com/robots.json", PublicKey: key}, valid: true},
+		{name: "BadPublicKey", source: RobotsSource{URL: "https://example.com/robots.json", PublicKey: "abc"}},
+		{name: "SignatureURL", source: RobotsSource{URL: "https://example.com/robots.json", PublicKey: key, SignatureURL: "https://example.com/sig"}, valid: true},
+		{name: "SignatureURLNoKey", source: RobotsSource{URL: "https://example.com/robots.json", SignatureURL: "https://example.com/sig"}},
+		{name: "Client", source: RobotsSource{URL: "https://example.com/robots.json", ProxyURL: "http://proxy:3128", ConnectTimeout: "5s", Timeout: "1m", MaxSize: 1}, valid: true},
+		{name: "BadProxyURL", source: RobotsSource{URL: "https://example.com/robots.json", ProxyURL: "proxy"}},
+		{name: "BadTimeout", source: RobotsSource{URL: "https://example.com/robots.json", Timeout: "soon"}},
+		{name: "ZeroConnectTimeout", source: RobotsSource{URL: "https://example.com/robots.json", ConnectTimeout: "0s"}},
+		{name: "NegativeMaxSize", source: RobotsSource{URL: "https://example.com/robots.json", MaxSize: -1}},
+		{name: "Merge", source: RobotsSource{URL: "https://example.com/robots.json", Interval: "1h", Priority: 2, Merge: "keep_first"}, valid: true},
+		{name: "BadInterval", source: RobotsSource{URL: "https://example.com/robots.json", Interval: "-1h"}},
+		{name: "BadMerge", source: RobotsSource{URL: "https://example.com/robots.json", Merge: "REPLACE"}},
+		{name: "Format", source: RobotsSource{URL: "https://example.com/robots.json", Format: "json"}, valid: true},
+		{name: "BadFormat", source: RobotsSource{URL: "https://example.com/robots.json", Format: "YAML"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			c.RobotsSources = []RobotsSource{tt.source}
+			err := c.ValidateConfig()
+			if tt.valid && err != nil {
+				t.Errorf("expected valid configuration, got %s", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected invalid configuration")
+			}
+		})
+	}
+
+	c := New()
+	c.RobotsSources = []RobotsSource{{URL: "https://example.com/robots.json"}}
+	if l := c.SourceList(); len(l) != 1 || l[0].URL != "https://example.com/robots.json" {
+		t.Errorf("expected RobotsSources to take precedence, got %+v", l)
+	}
+	pc := c.ProfileConfig(Profile{Hosts: "example.com", RobotsSourceURL: "https://example.com/other.txt"})
+	if l := pc.SourceList(); len(l) != 1 || l[0].URL != "https://example.com/other.txt" {
+		t.Errorf("expected a profile's RobotsSourceURL to replace RobotsSources, got %+v", l)
+	}
+}
@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+// Suppressed summarizes the log lines for a bot and client IP that were suppressed during a window.
+type Suppressed struct {
+	Bot    string
+	IP     string
+	Count  int
+	Window time.Duration
+}
+
+type limiterEntry struct {
+	start      time.Time
+	suppressed int
+}
+
+// Limiter suppresses repeated log lines for the same bot and client IP, allowing one line per window.
+type Limiter struct {
+	entries map[[2]string]*limiterEntry
+	lock    sync.Mutex
+	window  time.Duration
+}
+
+// NewLimiter initializes a Limiter allowing one log line per bot and client IP within each window.
+func NewLimiter(window time.Duration) *Limiter {
+	return &Limiter{
+		entries: make(map[[2]string]*limiterEntry),
+		window:  window,
+	}
+}
+
+// Allow reports whether a line for the bot and client IP should be logged, counting it as suppressed if not.
+// If the previous window for the pair has ended with lines suppressed, a summary of them is also returned.
+func (l *Limiter) Allow(bot string, ip string, now time.Time) (bool, *Suppressed) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	k := [2]string{bot, ip}
+	e, ok := l.entries[k]
+	if ok && now.Sub(e.start) < l.window {
+		e.suppressed++
+		return false, nil
+	}
+
+	var s *Suppressed
+	if ok && e.suppressed > 0 {
+		s = &Suppressed{Bot: bot, IP: ip, Count: e.suppressed, Window: l.window}
+	}
+	l.entries[k] = &limiterEntry{start: now}
+	return true, s
+}
+
+// Expire removes each bot and client IP pair whose window has ended, returning a summary for those with lines suppressed.
+func (l *Limiter) Expire(now time.Time) []Suppressed {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var res []Suppressed
+	for k, e := range l.entries {
+		if now.Sub(e.start) < l.window {
+			continue
+		}
+		if e.suppressed > 0 {
+			res = append(res, Suppressed{Bot: k[0], IP: k[1], Count: e.suppressed, Window: l.window})
+		}
+		delete(l.entries, k)
+	}
+	return res
+}
@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLimiter tests that one line is allowed per bot and client IP within a window, with the rest counted and summarized
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(time.Minute)
+	start := time.Now()
+
+	if allow, _ := l.Allow("GPTBot", "192.0.2.1", start); !allow {
+		t.Error("expected the first line for a bot and client IP to be allowed")
+	}
+	for i := 0; i < 3; i++ { //nolint:intrange,modernize
+		if allow, _ := l.Allow("GPTBot", "192.0.2.1", start.Add(time.Second)); allow {
+			t.Error("expected repeated lines within the window to be suppressed")
+		}
+	}
+	if allow, _ := l.Allow("GPTBot", "192.0.2.2", start); !allow {
+		t.Error("expected a line from another client IP to be allowed")
+	}
+
+	allow, s := l.Allow("GPTBot", "192.0.2.1", start.Add(time.Minute))
+	if !allow || s == nil || s.Count != 3 || s.Bot != "GPTBot" || s.IP != "192.0.2.1" {
+		t.Errorf("expected a line after the window to be allowed, with a summary of the 3 suppressed lines. Got %t %+v", allow, s)
+	}
+}
+
+// TestLimiterExpire tests that expired windows are removed, with summaries only for those that suppressed lines
+func TestLimiterExpire(t *testing.T) {
+	l := NewLimiter(time.Minute)
+	start := time.Now()
+	l.Allow("GPTBot", "192.0.2.1", start)
+	l.Allow("GPTBot", "192.0.2.1", start)
+	l.Allow("ClaudeBot", "192.0.2.1", start)
+
+	if got := l.Expire(start.Add(time.Second)); len(got) != 0 {
+		t.Errorf("expected nothing to expire within the window, got %v", got)
+	}
+	got := l.Expire(start.Add(time.Minute))
+	if len(got) != 1 || got[0].Bot != "GPTBot" || got[0].Count != 1 {
+		t.Errorf("expected a single summary for the bot with a suppressed line, got %v", got)
+	}
+	if len(l.entries) != 0 {
+		t.Errorf("expected expired entries to be removed, %d remain", len(l.entries))
+	}
+}
@@ -6,6 +6,13 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"strings"
+)
+
+const (
+	formatJSON        = "JSON"
+	destinationStdout = "stdout"
+	destinationStderr = "stderr"
 )
 
 // Log struct for the logger.
@@ -20,6 +27,11 @@ func New(lvl string) *Log {
 
 // NewFromWriter initializes the logger to write to the provided io.Writer. Output configured by lvl parameter.
 func NewFromWriter(lvl string, w io.Writer) *Log {
+	return NewWithFormat(lvl, "", w)
+}
+
+// NewWithFormat initializes the logger to write to the provided io.Writer in the provided format, either TEXT or JSON.
+func NewWithFormat(lvl string, format string, w io.Writer) *Log {
 	var sLvl slog.Level
 	// Level.UnmarshalText handles string comp. we already handle string validation in config.ValidateConfig()
 	_ = sLvl.UnmarshalText([]byte(lvl))
@@ -27,7 +39,26 @@ func NewFromWriter(lvl string, w io.Writer) *Log {
 		slog.String("pluginName", "bot-wrangler-traefik-plugin"),
 	}
 	// we can't set just HandlerOptions.AddSource=true, it'll just showup as reflect src
-	log := slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: sLvl}).WithAttrs(defaultAttrs))
-	slog.SetDefault(log)
-	return &Log{log}
+	opts := &slog.HandlerOptions{Level: sLvl}
+	var h slog.Handler
+	if strings.ToUpper(format) == formatJSON {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	// we don't touch slog's default logger, it is shared with every other plugin running in Traefik
+	return &Log{slog.New(h.WithAttrs(defaultAttrs))}
+}
+
+// OpenDestination returns a writer for the provided log destination: stdout, stderr, or a file path.
+// Files are rotated once they exceed maxSize bytes, keeping up to the provided number of backups.
+func OpenDestination(dest string, maxSize int64, backups int) (io.Writer, error) {
+	switch strings.ToLower(dest) {
+	case "", destinationStdout:
+		return os.Stdout, nil
+	case destinationStderr:
+		return os.Stderr, nil
+	default:
+		return NewRotatingFile(dest, maxSize, backups)
+	}
 }
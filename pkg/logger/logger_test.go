@@ -3,7 +3,9 @@ package logger
 import (
 	"bytes"
 	"fmt"
+	"os"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -70,3 +72,32 @@ func TestLogLevel(t *testing.T) {
 		}
 	})
 }
+
+// TestLogFormatJSON tests that the logger writes JSON records when the JSON format is requested
+func TestLogFormatJSON(t *testing.T) {
+	out := &bytes.Buffer{}
+	log := NewWithFormat("INFO", "json", out)
+	log.Info("Test JSON!", "userAgent", "GPTBot")
+	want := `"level":"INFO","msg":"Test JSON!","pluginName":"bot-wrangler-traefik-plugin","userAgent":"GPTBot"}`
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("Log.Info() did not write the expected JSON output! Wanted '%s', Got '%s'", want, out.String())
+	}
+}
+
+// TestOpenDestination tests that stdout and stderr are recognized, and anything else is treated as a file path
+func TestOpenDestination(t *testing.T) {
+	w, err := OpenDestination("STDERR", 1024, 1)
+	if err != nil || w != os.Stderr {
+		t.Errorf("expected 'stderr' destination to write to os.Stderr, got %v (%v)", w, err)
+	}
+	p := t.TempDir() + "/plugin.log"
+	w, err = OpenDestination(p, 1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, ok := w.(*RotatingFile)
+	if !ok {
+		t.Fatalf("expected a file path destination to return a RotatingFile, got %T", w)
+	}
+	_ = f.Close()
+}
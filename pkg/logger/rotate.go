@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"os"
+	"strconv"
+	"sync"
+)
+
+// RotatingFile is an io.Writer to a file that is rotated once it reaches a maximum size.
+// Rotated files are renamed with an increasing numeric suffix, keeping up to the configured number of backups.
+type RotatingFile struct {
+	backups int
+	file    *os.File
+	lock    sync.Mutex
+	maxSize int64
+	path    string
+	size    int64
+}
+
+// NewRotatingFile opens (or creates) the file at path for appending, rotating it once it exceeds maxSize bytes.
+func NewRotatingFile(path string, maxSize int64, backups int) (*RotatingFile, error) {
+	r := &RotatingFile{
+		backups: backups,
+		maxSize: maxSize,
+		path:    path,
+	}
+	err := r.open()
+	return r, err
+}
+
+// open opens the file at the path, replacing the one being written to only once it has opened.
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if r.file != nil {
+		_ = r.file.Close()
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+// Write appends to the file, rotating it first if the write would exceed the maximum size.
+// If the rotation fails, the write still goes to the current file and the error is returned with it.
+// The rotation is then only retried once the file grows by the maximum size again, rather than on every write.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var rotateErr error
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		rotateErr = r.rotate()
+		if rotateErr != nil {
+			r.size = 0
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotate shifts each backup up by one, discarding the oldest, and starts a new file.
+// If another writer to the same path already rotated it, such as the instance being replaced by a configuration reload, the new file is opened instead.
+// The current file is kept open until the new one is, so a failed rotation leaves it usable.
+func (r *RotatingFile) rotate() error {
+	if !r.replaced() {
+		var err error
+		if r.backups > 0 {
+			for i := r.backups - 1; i > 0; i-- {
+				_ = os.Rename(r.path+"."+strconv.Itoa(i), r.path+"."+strconv.Itoa(i+1))
+			}
+			err = os.Rename(r.path, r.path+".1")
+		} else {
+			err = os.Remove(r.path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return r.open()
+}
+
+// replaced reports whether the file at the path is no longer the one being written to.
+func (r *RotatingFile) replaced() bool {
+	cur, err := os.Stat(r.path)
+	if err != nil {
+		return true
+	}
+	ours, err := r.file.Stat()
+	if err != nil {
+		return false
+	}
+	return !os.SameFile(cur, ours)
+}
+
+// Close closes the underlying file.
+func (r *RotatingFile) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.file.Close()
+}
@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestRotatingFile tests that the file is rotated once it exceeds the maximum size, and only the configured number of backups are kept
+func TestRotatingFile(t *testing.T) {
+	p := t.TempDir() + "/audit.log"
+	r, err := NewRotatingFile(p, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+
+	for _, l := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		_, err = r.Write([]byte(l))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for suffix, want := range map[string]string{"": "dddddddd\n", ".1": "cccccccc\n", ".2": "bbbbbbbb\n"} {
+		got, err := os.ReadFile(p + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("expected '%s' to contain '%s', got '%s'", p+suffix, strings.TrimSpace(want), strings.TrimSpace(string(got)))
+		}
+	}
+	if _, err = os.Stat(p + ".3"); !os.IsNotExist(err) {
+		t.Error("expected backups beyond the configured count to be discarded")
+	}
+}
+
+// TestRotatingFileShared tests that two writers to the same path don't both rotate it, which would push the newest backup out early
+func TestRotatingFileShared(t *testing.T) {
+	p := t.TempDir() + "/audit.log"
+	a, err := NewRotatingFile(p, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = a.Close() }()
+	b, err := NewRotatingFile(p, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = b.Close() }()
+
+	for _, w := range []struct {
+		r *RotatingFile
+		l string
+	}{{a, "aaaaaaaa\n"}, {a, "bbbbbbbb\n"}, {b, "cccccccc\n"}} {
+		_, err = w.r.Write([]byte(w.l))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b still sees its own, smaller size of the original file, so rotates only when it reaches its limit, finding a already did
+	_, err = b.Write([]byte("dddddddd\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for suffix, want := range map[string]string{"": "bbbbbbbb\ndddddddd\n", ".1": "aaaaaaaa\ncccccccc\n"} {
+		got, err := os.ReadFile(p + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("expected '%s' to contain '%s', got '%s'", p+suffix, want, string(got))
+		}
+	}
+	if _, err = os.Stat(p + ".2"); !os.IsNotExist(err) {
+		t.Error("expected the file to be rotated once")
+	}
+}
+
+// TestRotatingFileRotateError tests that writes continue to the current file when it can't be rotated, and rotation resumes once it can
+func TestRotatingFileRotateError(t *testing.T) {
+	p := t.TempDir() + "/audit.log"
+	r, err := NewRotatingFile(p, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = r.Close() }()
+	// a directory in the way of the backup makes the rename fail
+	err = os.Mkdir(p+".1", 0o750)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Write([]byte("aaaaaaaa\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := r.Write([]byte("bbbbbbbb\n"))
+	if err == nil || n != 9 {
+		t.Errorf("expected the rotation error to be returned along with the write, got %d bytes and error %v", n, err)
+	}
+	got, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "aaaaaaaa\nbbbbbbbb\n" {
+		t.Errorf("expected the write to go to the current file, got '%s'", got)
+	}
+
+	err = os.Remove(p + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Write([]byte("cccccccc\n"))
+	if err != nil {
+		t.Fatalf("expected the file to be rotated once the backup could be written, got %s", err)
+	}
+	for suffix, want := range map[string]string{"": "cccccccc\n", ".1": "aaaaaaaa\nbbbbbbbb\n"} {
+		got, err := os.ReadFile(p + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("expected '%s' to contain '%s', got '%s'", p+suffix, want, string(got))
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Package maze provides an endless, generated "link maze" to trap crawlers that ignore robots.txt.
+package maze
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// words used to generate page content. Picked from the path hash, so no randomness is involved.
+	wordList = `the of and archive index notes report summary draft chapter section volume record entry
+		history catalog review journal letter memo paper study survey digest ledger bulletin brief
+		analysis overview appendix glossary manual guide reference document collection series issue`
+
+	paragraphs         = 3
+	wordsPerParagraph  = 40
+	wordsPerTitle      = 4
+	linkSegmentHexSize = 16
+)
+
+// Maze generates deterministic HTML pages of links that only lead to more generated pages under a path prefix.
+type Maze struct {
+	prefix string
+	links  int
+	words  []string
+}
+
+// New returns a Maze that serves pages under the provided path prefix, each containing the provided number of links.
+func New(prefix string, links int) *Maze {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &Maze{
+		prefix: prefix,
+		links:  links,
+		words:  strings.Fields(wordList),
+	}
+}
+
+// Prefix returns the path prefix that the maze lives under.
+func (m *Maze) Prefix() string {
+	return m.prefix
+}
+
+// Contains reports whether the provided request path is inside the maze.
+func (m *Maze) Contains(p string) bool {
+	return strings.HasPrefix(p, m.prefix)
+}
+
+// ServeHTTP renders the maze page for the requested path. The same path always yields the same page.
+func (m *Maze) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page := m.Render(r.URL.Path)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(page))
+}
+
+// Render generates the HTML page for the provided path.
+func (m *Maze) Render(p string) string {
+	seed := sha256.Sum256([]byte(p))
+	var sb strings.Builder
+
+	title := m.phrase(seed[:], wordsPerTitle)
+	sb.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>")
+	sb.WriteString(title)
+	sb.WriteString("</title></head><body>\n<h1>")
+	sb.WriteString(title)
+	sb.WriteString("</h1>\n")
+
+	// each paragraph and link hashes the seed with its own counter, so content never repeats within a page
+	// yaegi doesn't like a range over int loop
+	// https://github.com/traefik/yaegi/issues/1701
+	for i := 0; i < paragraphs; i++ { //nolint:intrange,modernize
+		h := derive(seed, "p", i)
+		sb.WriteString("<p>")
+		sb.WriteString(m.phrase(h[:], wordsPerParagraph))
+		sb.WriteString("</p>\n")
+	}
+	sb.WriteString("<ul>\n")
+	for i := 0; i < m.links; i++ { //nolint:intrange,modernize
+		h := derive(seed, "l", i)
+		href := m.prefix + hex.EncodeToString(h[:])[:linkSegmentHexSize]
+		_, _ = fmt.Fprintf(&sb, "<li><a href=\"%s\">%s</a></li>\n", href, m.phrase(h[:], wordsPerTitle))
+	}
+	sb.WriteString("</ul>\n</body></html>\n")
+	return sb.String()
+}
+
+// phrase builds a string of n words, selected by consuming the provided hash two bytes at a time.
+func (m *Maze) phrase(h []byte, n int) string {
+	out := make([]string, n)
+	for i := 0; i < n; i++ { //nolint:intrange,modernize
+		// wrap around the hash if more words are needed than it has bytes for
+		o := (i * 2) % (len(h) - 1)
+		idx := int(binary.BigEndian.Uint16(h[o:o+2])+uint16(i)) % len(m.words)
+		out[i] = m.words[idx]
+	}
+	return strings.Join(out, " ")
+}
+
+// derive returns a new hash from the page seed, a label, and a counter.
+func derive(seed [sha256.Size]byte, label string, i int) [sha256.Size]byte {
+	return sha256.Sum256([]byte(fmt.Sprintf("%x/%s/%d", seed, label, i)))
+}
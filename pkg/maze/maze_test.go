@@ -0,0 +1,73 @@
+package maze
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestMazeDeterministic tests that the same path always renders the same page, and different paths render different pages
+func TestMazeDeterministic(t *testing.T) {
+	m := New("/maze/", 5)
+	first := m.Render("/maze/abc")
+	second := m.Render("/maze/abc")
+	other := m.Render("/maze/def")
+	if first != second {
+		t.Error("rendering the same maze path twice yielded different pages")
+	}
+	if first == other {
+		t.Error("rendering different maze paths yielded the same page")
+	}
+}
+
+// TestMazeLinks tests that every generated link stays inside the maze, and the configured amount of links are rendered
+func TestMazeLinks(t *testing.T) {
+	want := 7
+	m := New("/maze", want)
+	page := m.Render("/maze/start")
+	re := regexp.MustCompile(`href="([^"]+)"`)
+	links := re.FindAllStringSubmatch(page, -1)
+	if len(links) != want {
+		t.Errorf("expected %d links in maze page, got %d", want, len(links))
+	}
+	for _, l := range links {
+		if !m.Contains(l[1]) {
+			t.Errorf("maze link '%s' leads outside of the maze prefix '%s'", l[1], m.Prefix())
+		}
+	}
+}
+
+// TestMazeContains tests path prefix matching for the maze
+func TestMazeContains(t *testing.T) {
+	m := New("/maze/", 1)
+	if !m.Contains("/maze/abc") {
+		t.Error("expected path inside maze prefix to be contained")
+	}
+	if m.Contains("/mazes") || m.Contains("/") {
+		t.Error("expected path outside maze prefix to not be contained")
+	}
+}
+
+// TestMazeServeHTTP tests that the maze responds with an HTML page
+func TestMazeServeHTTP(t *testing.T) {
+	m := New("/maze/", 3)
+	recorder := httptest.NewRecorder()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://localhost/maze/abc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.ServeHTTP(recorder, req)
+	res := recorder.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected maze to return status 200, got %d", res.StatusCode)
+	}
+	if !strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("expected maze to return HTML content, got '%s'", res.Header.Get("Content-Type"))
+	}
+	if recorder.Body.String() != m.Render("/maze/abc") {
+		t.Error("maze response body did not match rendered page for the requested path")
+	}
+}
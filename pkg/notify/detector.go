@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"sync"
+	"time"
+)
+
+type detectorWindow struct {
+	count   int
+	crossed bool
+	start   time.Time
+}
+
+// Detector tracks the bots seen, to find the first sighting of each bot, and bots exceeding a number of hits within a window.
+type Detector struct {
+	lock      sync.Mutex
+	seen      map[string]*detectorWindow
+	threshold int
+	window    time.Duration
+}
+
+// NewDetector initializes a Detector. A threshold of 0 disables threshold detection.
+func NewDetector(threshold int, window time.Duration) *Detector {
+	return &Detector{
+		seen:      make(map[string]*detectorWindow),
+		threshold: threshold,
+		window:    window,
+	}
+}
+
+// Observe records a hit from the bot. It returns whether this is the first time the bot has been seen,
+// and the bot's hit count if this hit crossed the threshold for the current window (otherwise 0).
+func (d *Detector) Observe(bot string, now time.Time) (bool, int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	w, ok := d.seen[bot]
+	if !ok {
+		w = &detectorWindow{start: now}
+		d.seen[bot] = w
+	}
+	if now.Sub(w.start) >= d.window {
+		*w = detectorWindow{start: now}
+	}
+	w.count++
+	if d.threshold > 0 && !w.crossed && w.count >= d.threshold {
+		// only notify once per window
+		w.crossed = true
+		return !ok, w.count
+	}
+	return !ok, 0
+}
+
+// Window returns the window hits are counted within.
+func (d *Detector) Window() time.Duration {
+	return d.window
+}
@@ -0,0 +1,164 @@
+// Package notify provides the Notifier type, which delivers events to webhooks.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/logger"
+)
+
+// types of events delivered to webhooks.
+const (
+	EventNewBot        = "bot.new"
+	EventThreshold     = "bot.threshold"
+	EventRefreshFailed = "source.refreshFailed"
+	EventIndexChanged  = "source.indexChanged"
+
+	// SignatureHeader holds the HMAC-SHA256 of the request body, when a secret is configured.
+	SignatureHeader = "X-Bot-Wrangler-Signature"
+
+	requestTimeout = 10 * time.Second
+)
+
+// Event is the JSON payload delivered to webhooks.
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	Middleware string    `json:"middleware"`
+	BotName    string    `json:"botName,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	ClientIP   string    `json:"clientIp,omitempty"`
+	Host       string    `json:"host,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Count      int       `json:"count,omitempty"`
+	Window     string    `json:"window,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Source     string    `json:"source,omitempty"`
+	Added      []string  `json:"added,omitempty"`
+	Removed    []string  `json:"removed,omitempty"`
+	Changed    []string  `json:"changed,omitempty"`
+}
+
+// Notifier queues events, and delivers them to each configured webhook in the background.
+type Notifier struct {
+	backoff time.Duration
+	client  *http.Client
+	log     *logger.Log
+	name    string
+	queue   chan Event
+	retries int
+	secret  []byte
+	urls    []string
+}
+
+// New initializes a Notifier from the provided (validated) plugin configuration, delivering events until the context is canceled.
+func New(ctx context.Context, c *config.Config, l *logger.Log, name string) *Notifier {
+	// we validated the time duration earlier, so ignore any error now
+	backoff, _ := time.ParseDuration(c.NotifyRetryBackoff)
+	var urls []string
+	for _, u := range strings.Split(c.NotifyWebhookURLs, ",") {
+		urls = append(urls, strings.TrimSpace(u))
+	}
+	n := &Notifier{
+		backoff: backoff,
+		client:  &http.Client{Timeout: requestTimeout},
+		log:     l,
+		name:    name,
+		queue:   make(chan Event, c.NotifyQueueSize),
+		retries: c.NotifyRetries,
+		secret:  []byte(c.NotifySecret),
+		urls:    urls,
+	}
+	go n.run(ctx)
+	return n
+}
+
+// Notify queues an event for delivery. The event is dropped if the queue is full, so a slow webhook never holds up requests.
+func (n *Notifier) Notify(e Event) {
+	e.Middleware = n.name
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	select {
+	case n.queue <- e:
+	default:
+		n.log.Warn("Notify: queue is full, dropping event", "event", e.Type, "botName", e.BotName)
+	}
+}
+
+func (n *Notifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-n.queue:
+			body, err := json.Marshal(e)
+			if err != nil {
+				n.log.Error("Notify: unable to encode event. " + err.Error())
+				continue
+			}
+			for _, u := range n.urls {
+				n.deliver(ctx, u, body)
+			}
+		}
+	}
+}
+
+// deliver sends the payload to the webhook, retrying with exponential backoff on failure.
+func (n *Notifier) deliver(ctx context.Context, u string, body []byte) {
+	wait := n.backoff
+	for attempt := 0; ; attempt++ {
+		err := n.send(ctx, u, body)
+		if err == nil {
+			return
+		}
+		if attempt >= n.retries {
+			n.log.Warn("Notify: giving up delivering event to webhook. "+err.Error(), "url", u, "attempts", attempt+1)
+			return
+		}
+		n.log.Debug("Notify: failed to deliver event to webhook, retrying in "+wait.String()+". "+err.Error(), "url", u)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (n *Notifier) send(ctx context.Context, u string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(n.secret) > 0 {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(n.secret, body))
+	}
+	res, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook responded with status %s", res.Status)
+	}
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the body with the provided secret, for verifying a delivered event.
+func Sign(secret []byte, body []byte) string {
+	m := hmac.New(sha256.New, secret)
+	_, _ = m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
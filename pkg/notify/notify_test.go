@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/logger"
+)
+
+// testContext is a helper function to get a context that is canceled when the test finishes, stopping delivery
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// TestNotifierDeliver tests that events are delivered as signed JSON, and retried when the webhook fails
+func TestNotifierDeliver(t *testing.T) {
+	type delivery struct {
+		body      []byte
+		signature string
+	}
+	deliveries := make(chan delivery, 10)
+	var lock sync.Mutex
+	attempts := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		attempts++
+		first := attempts == 1
+		lock.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{body: body, signature: r.Header.Get(SignatureHeader)}
+	}))
+	defer s.Close()
+
+	c := config.New()
+	c.NotifyWebhookURLs = s.URL
+	c.NotifySecret = "hunter2"
+	c.NotifyRetryBackoff = "1ms"
+	n := New(testContext(t), c, logger.NewFromWriter("DEBUG", io.Discard), "wrangler")
+	n.Notify(Event{Type: EventNewBot, BotName: "GPTBot"})
+
+	select {
+	case d := <-deliveries:
+		if d.signature != "sha256="+Sign([]byte(c.NotifySecret), d.body) {
+			t.Errorf("delivered event was not signed with the configured secret. Got '%s'", d.signature)
+		}
+		var e Event
+		err := json.Unmarshal(d.body, &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Type != EventNewBot || e.BotName != "GPTBot" || e.Middleware != "wrangler" || e.Time.IsZero() {
+			t.Errorf("delivered event did not match the event notified. Got %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event was not delivered after the webhook recovered")
+	}
+}
+
+// TestNotifierQueueFull tests that events are dropped rather than blocking when the queue is full
+func TestNotifierQueueFull(t *testing.T) {
+	c := config.New()
+	c.NotifyWebhookURLs = "http://localhost"
+	c.NotifyQueueSize = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	// a canceled context stops the queue from being drained
+	cancel()
+	n := New(ctx, c, logger.NewFromWriter("DEBUG", io.Discard), "wrangler")
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		n.Notify(Event{Type: EventNewBot})
+		n.Notify(Event{Type: EventNewBot})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Notify() blocked when the queue was full")
+	}
+}
+
+// TestDetector tests that the first sighting of a bot is reported, and that crossing the threshold is reported once per window
+func TestDetector(t *testing.T) {
+	d := NewDetector(3, time.Minute)
+	start := time.Now()
+
+	first, count := d.Observe("GPTBot", start)
+	if !first || count != 0 {
+		t.Errorf("expected the first hit to be reported as a new bot, got %t %d", first, count)
+	}
+	d.Observe("GPTBot", start)
+	first, count = d.Observe("GPTBot", start)
+	if first || count != 3 {
+		t.Errorf("expected the third hit to cross the threshold, got %t %d", first, count)
+	}
+	if _, count = d.Observe("GPTBot", start); count != 0 {
+		t.Error("expected the threshold to only be reported once per window")
+	}
+	d.Observe("GPTBot", start.Add(time.Minute))
+	d.Observe("GPTBot", start.Add(time.Minute))
+	if _, count = d.Observe("GPTBot", start.Add(time.Minute)); count != 3 {
+		t.Errorf("expected the threshold to be reported again in a new window, got %d", count)
+	}
+}
@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaults for sources that don't customize their HTTP client.
+const (
+	DefaultConnectTimeout = 10 * time.Second
+	DefaultTimeout        = 30 * time.Second
+	DefaultMaxSize        = 10 * 1024 * 1024
+
+	// maxRedirects matches the limit of the default redirect policy.
+	maxRedirects = 10
+)
+
+// ClientOptions customizes the HTTP client a source's content is requested with.
+type ClientOptions struct {
+	// CAFile is a PEM bundle of certificate authorities to trust, in addition to the system's.
+	CAFile string
+	// ProxyURL is the HTTP proxy requests are sent through. Defaults to the proxy set in the environment.
+	ProxyURL       string
+	ConnectTimeout time.Duration
+	Timeout        time.Duration
+}
+
+// withDefaults returns the options with zero timeouts replaced by defaults.
+func (o ClientOptions) withDefaults() ClientOptions {
+	if o.ConnectTimeout == 0 {
+		o.ConnectTimeout = DefaultConnectTimeout
+	}
+	if o.Timeout == 0 {
+		o.Timeout = DefaultTimeout
+	}
+	return o
+}
+
+// NewClient builds an HTTP client for retrieving sources with the provided options. Zero timeouts are replaced by defaults.
+func NewClient(o ClientOptions) (*http.Client, error) {
+	o = o.withDefaults()
+	t := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         (&net.Dialer{Timeout: o.ConnectTimeout}).DialContext,
+		ForceAttemptHTTP2:   true,
+		TLSHandshakeTimeout: o.ConnectTimeout,
+	}
+	if o.ProxyURL != "" {
+		u, err := url.Parse(o.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL '%s'. %w", o.ProxyURL, err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle. %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA bundle '" + o.CAFile + "'")
+		}
+		t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &http.Client{Transport: t, Timeout: o.Timeout, CheckRedirect: checkRedirect}, nil
+}
+
+// checkRedirect follows up to maxRedirects redirects, like the default policy. On a redirect to another scheme or host,
+// the headers set on the original request, such as a source's configured headers, are removed so that they aren't leaked.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	orig := via[0].URL
+	if !strings.EqualFold(req.URL.Scheme, orig.Scheme) || !strings.EqualFold(req.URL.Host, orig.Host) {
+		for k := range via[0].Header {
+			req.Header.Del(k)
+		}
+	}
+	return nil
+}
+
+// client returns the HTTP client to retrieve the source with.
+func (s *Source) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return &http.Client{Timeout: DefaultTimeout, CheckRedirect: checkRedirect}
+}
+
+// get requests the provided URL with the source's client and headers.
+// The headers are only sent to the source's own scheme and host, so that they aren't leaked to another server, such as one hosting its signature.
+// The bearer token file is read for each request, so the token can be rotated without a restart.
+func (s *Source) get(u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.sameOrigin(req.URL) {
+		err = s.setHeaders(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	maxSize := s.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	resp.Body = http.MaxBytesReader(nil, resp.Body, maxSize)
+	return resp, nil
+}
+
+// sameOrigin reports whether the URL has the same scheme and host as the source.
+func (s *Source) sameOrigin(u *url.URL) bool {
+	src, err := url.Parse(s.URL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(src.Scheme, u.Scheme) && strings.EqualFold(src.Host, u.Host)
+}
+
+// setHeaders adds the source's configured headers and bearer token to the request.
+func (s *Source) setHeaders(req *http.Request) error {
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	if s.BearerTokenFile != "" {
+		token, err := os.ReadFile(s.BearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("unable to read bearer token for '%s'. %w", s.URL, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package parser
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSourceHeaders tests that configured headers and the bearer token read from a file are sent with each request
+func TestSourceHeaders(t *testing.T) {
+	var gotAuth, gotHeader string
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotHeader = r.Header.Get("X-Team")
+		_, _ = w.Write([]byte(exampleSourceRobotsTxt))
+	}))
+	defer serv.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	err := os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Source{URL: serv.URL, Headers: map[string]string{"X-Team": "bots"}, BearerTokenFile: tokenFile}
+	_, err = s.GetIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotAuth != "Bearer s3cret" || gotHeader != "bots" {
+		t.Errorf("expected configured headers to be sent, got Authorization '%s' and X-Team '%s'", gotAuth, gotHeader)
+	}
+
+	s.BearerTokenFile = filepath.Join(t.TempDir(), "missing")
+	_, err = s.GetIndex()
+	if err == nil {
+		t.Error("expected an error when the bearer token file can't be read")
+	}
+}
+
+// TestSourceHeadersRedirect tests that configured headers follow a redirect on the same host, but are removed on a redirect to another host
+func TestSourceHeadersRedirect(t *testing.T) {
+	var gotAuth, gotHeader string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotHeader = r.Header.Get("X-Team")
+		_, _ = w.Write([]byte(exampleSourceRobotsTxt))
+	}))
+	defer other.Close()
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/robots.txt", http.StatusFound)
+		case "/elsewhere":
+			http.Redirect(w, r, other.URL+"/robots.txt", http.StatusFound)
+		default:
+			gotAuth = r.Header.Get("Authorization")
+			gotHeader = r.Header.Get("X-Team")
+			_, _ = w.Write([]byte(exampleSourceRobotsTxt))
+		}
+	}))
+	defer serv.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	err := os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		path    string
+		headers bool
+	}{
+		{path: "/moved", headers: true},
+		{path: "/elsewhere"},
+	} {
+		gotAuth, gotHeader = "", ""
+		s := &Source{URL: serv.URL + tt.path, Client: c, Headers: map[string]string{"X-Team": "bots"}, BearerTokenFile: tokenFile}
+		_, err = s.GetIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantAuth, wantHeader := "", ""
+		if tt.headers {
+			wantAuth, wantHeader = "Bearer s3cret", "bots"
+		}
+		if gotAuth != wantAuth || gotHeader != wantHeader {
+			t.Errorf("%s: expected Authorization '%s' and X-Team '%s', got '%s' and '%s'", tt.path, wantAuth, wantHeader, gotAuth, gotHeader)
+		}
+	}
+}
+
+// TestSourceMaxSize tests that content larger than the maximum size is rejected rather than parsed
+func TestSourceMaxSize(t *testing.T) {
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(exampleSourceRobotsTxt))
+	}))
+	defer serv.Close()
+
+	s := &Source{URL: serv.URL, MaxSize: int64(len(exampleSourceRobotsTxt) - 1)}
+	_, err := s.GetIndex()
+	if err == nil || !strings.Contains(err.Error(), "maximum size") {
+		t.Errorf("expected oversized content to be rejected, got %v", err)
+	}
+	s.MaxSize = int64(len(exampleSourceRobotsTxt))
+	_, err = s.GetIndex()
+	if err != nil {
+		t.Errorf("expected content within the maximum size to be accepted, got %s", err)
+	}
+}
+
+// TestSourceTimeout tests that a hung source is abandoned after the client's timeout
+func TestSourceTimeout(t *testing.T) {
+	done := make(chan struct{})
+	serv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		<-done
+	}))
+	defer serv.Close()
+	defer close(done)
+
+	c, err := NewClient(ClientOptions{Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Source{URL: serv.URL, Client: c}
+	start := time.Now()
+	_, err = s.GetIndex()
+	if err == nil {
+		t.Fatal("expected hung source to time out")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected source to time out promptly, took %s", time.Since(start))
+	}
+}
+
+// TestSourceCAFile tests that a source presenting a certificate from a custom CA is trusted only when that CA is configured
+func TestSourceCAFile(t *testing.T) {
+	serv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(exampleSourceRobotsTxt))
+	}))
+	defer serv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serv.Certificate().Raw}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewClient(ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&Source{URL: serv.URL, Client: c}).GetIndex()
+	if err == nil {
+		t.Error("expected certificate from an unknown CA to be rejected")
+	}
+
+	c, err = NewClient(ClientOptions{CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = (&Source{URL: serv.URL, Client: c}).GetIndex()
+	if err != nil {
+		t.Errorf("expected certificate from the configured CA to be trusted, got %s", err)
+	}
+
+	_, err = NewClient(ClientOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	if err == nil {
+		t.Error("expected an error for a missing CA bundle")
+	}
+}
+
+// TestSourceProxy tests that requests are sent through the configured proxy
+func TestSourceProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		_, _ = w.Write([]byte(exampleSourceRobotsTxt))
+	}))
+	defer proxy.Close()
+
+	c, err := NewClient(ClientOptions{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := (&Source{URL: "http://bots.internal/robots.txt", Client: c}).GetIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxied != "http://bots.internal/robots.txt" {
+		t.Errorf("expected request to be sent through the proxy, got '%s'", proxied)
+	}
+	if _, ok := i["MyBot"]; !ok {
+		t.Errorf("expected proxied content to be parsed, got %v", i)
+	}
+}
@@ -0,0 +1,87 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// crawlerMetadata holds metadata about a crawler. Populated from a crawler-user-agents.json source.
+type crawlerMetadata struct {
+	URL          string
+	Instances    []string
+	AdditionDate string
+}
+
+// crawlerEntry is an entry of the crawler-user-agents.json schema, see https://github.com/monperrus/crawler-user-agents.
+type crawlerEntry struct {
+	Pattern      string   `json:"pattern"`
+	URL          string   `json:"url"`
+	Instances    []string `json:"instances"`
+	AdditionDate string   `json:"addition_date"`
+	Description  string   `json:"description"`
+}
+
+// crawlerUserAgentsParse parses a list of crawlers in the crawler-user-agents.json schema.
+// Each entry's pattern is a regular expression, which is used as its name in the index.
+// Entries without a pattern, or with one that doesn't compile (such as one using lookarounds, which Go doesn't support), are skipped with a warning.
+// An error is only returned if none of the entries could be used.
+func crawlerUserAgentsParse(r *bufio.Reader) (RobotsIndex, []RobotsWarning, error) {
+	rIndex := make(RobotsIndex)
+	c, err := io.ReadAll(r)
+	if err != nil {
+		return rIndex, nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(c))
+	tok, err := dec.Token()
+	if err != nil {
+		return rIndex, nil, err
+	}
+	if tok != json.Delim('[') {
+		return rIndex, nil, errors.New("crawler list must be a JSON array")
+	}
+	var warnings []RobotsWarning
+	for dec.More() {
+		line := crawlerEntryLine(c, dec.InputOffset())
+		var e crawlerEntry
+		err = dec.Decode(&e)
+		if err != nil {
+			return rIndex, warnings, err
+		}
+		if e.Pattern == "" {
+			warnings = append(warnings, RobotsWarning{Line: line, Message: "missing required field 'pattern', skipping the entry"})
+			continue
+		}
+		re, err := regexp.Compile(e.Pattern)
+		if err != nil {
+			warnings = append(warnings, RobotsWarning{Line: line, Message: fmt.Sprintf("invalid pattern '%s', skipping the entry. %s", e.Pattern, err)})
+			continue
+		}
+		rIndex[e.Pattern] = BotUserAgent{
+			Pattern:         re,
+			JSONMetadata:    botMetadata{Description: e.Description},
+			CrawlerMetadata: crawlerMetadata{URL: e.URL, Instances: e.Instances, AdditionDate: e.AdditionDate},
+		}
+	}
+	_, err = dec.Token()
+	if err != nil {
+		return rIndex, warnings, err
+	}
+	if len(rIndex) == 0 && len(warnings) > 0 {
+		return rIndex, warnings, fmt.Errorf("no usable crawler entries, the first was skipped on %s", warnings[0])
+	}
+	return rIndex, warnings, nil
+}
+
+// crawlerEntryLine finds the line an entry of the list starts on, given the offset the previous one ended at.
+func crawlerEntryLine(c []byte, offset int64) int {
+	start := int(offset)
+	for start < len(c) && bytes.IndexByte([]byte(", \t\r\n"), c[start]) >= 0 {
+		start++
+	}
+	return bytes.Count(c[:start], []byte("\n")) + 1
+}
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testCrawlerUserAgents = `[
+  {
+    "pattern": "Googlebot\\/",
+    "url": "http://www.google.com/bot.html",
+    "instances": ["Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"],
+    "addition_date": "2017/01/01"
+  },
+  {
+    "pattern": "[wW]get",
+    "instances": ["Wget/1.21.4"],
+    "description": "GNU Wget"
+  }
+]`
+
+// TestCrawlerUserAgentsParse tests that a crawler-user-agents.json list is detected, and its patterns and metadata are preserved
+func TestCrawlerUserAgentsParse(t *testing.T) {
+	for _, contentType := range []string{"application/json", ""} {
+		t.Run("ContentType"+contentType, func(t *testing.T) {
+			serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if contentType != "" {
+					w.Header().Set("Content-Type", contentType)
+				}
+				_, _ = w.Write([]byte(testCrawlerUserAgents))
+			}))
+			defer serv.Close()
+
+			s := &Source{URL: serv.URL}
+			i, err := s.GetIndex()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if s.contentType != contentCrawlerUserAgents {
+				t.Errorf("expected content type '%s', got '%s'", contentCrawlerUserAgents, s.contentType)
+			}
+			if len(i) != 2 {
+				t.Fatalf("expected 2 bots, got %v", i)
+			}
+			g := i[`Googlebot\/`]
+			if g.Pattern == nil || !g.Pattern.MatchString("Googlebot/2.1") || g.Pattern.MatchString("Googlebot-Image") {
+				t.Errorf("expected Googlebot pattern to keep its regex semantics, got %v", g.Pattern)
+			}
+			if g.CrawlerMetadata.URL != "http://www.google.com/bot.html" || g.CrawlerMetadata.AdditionDate != "2017/01/01" || len(g.CrawlerMetadata.Instances) != 1 {
+				t.Errorf("expected crawler metadata to be preserved, got %+v", g.CrawlerMetadata)
+			}
+			if g.Source != serv.URL {
+				t.Errorf("expected source '%s', got '%s'", serv.URL, g.Source)
+			}
+			w := i["[wW]get"]
+			if w.JSONMetadata.Description != "GNU Wget" || !slices.Equal(w.CrawlerMetadata.Instances, []string{"Wget/1.21.4"}) {
+				t.Errorf("expected wget metadata to be preserved, got %+v", w)
+			}
+		})
+	}
+}
+
+// TestCrawlerUserAgentsParseSkip tests that entries without a pattern, or with one that doesn't compile, are skipped with a warning naming their line
+func TestCrawlerUserAgentsParseSkip(t *testing.T) {
+	content := `[
+  {"pattern": "Googlebot\\/"},
+  {"pattern": "(?<!Mobile )Safari"},
+  {"url": "https://example.com"},
+  {
+    "pattern": "[wW]get"
+  }
+]`
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(content))
+	}))
+	defer serv.Close()
+
+	s := &Source{URL: serv.URL, Format: FormatCrawlerUserAgents}
+	i, err := s.GetIndex()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, ok := i["[wW]get"]; !ok || len(i) != 2 {
+		t.Errorf("expected the usable entries to be kept, got %v", i)
+	}
+	want := []string{"line 3: invalid pattern '(?<!Mobile )Safari'", "line 4: missing required field 'pattern'"}
+	if len(s.Warnings) != len(want) {
+		t.Fatalf("expected %d warnings, got %v", len(want), s.Warnings)
+	}
+	for n, w := range want {
+		if !strings.HasPrefix(s.Warnings[n].String(), w) {
+			t.Errorf("expected a warning starting with '%s', got '%s'", w, s.Warnings[n])
+		}
+	}
+}
+
+// TestCrawlerUserAgentsParseInvalid tests that a list is rejected when it's malformed, or none of its entries can be used
+func TestCrawlerUserAgentsParseInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "MissingPattern", content: `[{"url": "https://example.com"}]`, want: "missing required field 'pattern'"},
+		{name: "InvalidPattern", content: `[{"pattern": "MyBot("}]`, want: "invalid pattern 'MyBot('"},
+		{name: "Malformed", content: `[{"pattern": "MyBot"`, want: "unexpected EOF"},
+		{name: "NotArray", content: `{"pattern": "MyBot"}`, want: "not a JSON array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(tt.content))
+			}))
+			defer serv.Close()
+
+			s := &Source{URL: serv.URL, Format: FormatCrawlerUserAgents}
+			_, err := s.GetIndex()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing '%s', got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// formats of source content, which a Source may declare rather than have detected.
+const (
+	FormatRobotsJSON = "JSON"
+	FormatRobotsTxt  = "ROBOTSTXT"
+	FormatPlaintext  = "PLAINTEXT"
+	// FormatCrawlerUserAgents is the schema of https://github.com/monperrus/crawler-user-agents.
+	FormatCrawlerUserAgents = "CRAWLER_USER_AGENTS"
+	// FormatNginx is an nginx `map $http_user_agent` block.
+	FormatNginx = "NGINX"
+	// FormatApache is Apache config matching the User-Agent, with RewriteCond, BrowserMatch, or SetEnvIf.
+	FormatApache = "APACHE"
+)
+
+// checkFormat verifies that the content matches the format declared by the source, so that a list isn't silently parsed as the wrong format.
+// Sources without a declared format are detected from their content instead.
+func (s *Source) checkFormat(content []byte) error {
+	if s.Format == "" {
+		return nil
+	}
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+	trimmed := bytes.TrimSpace(content)
+	switch s.Format {
+	case FormatRobotsJSON:
+		if !bytes.HasPrefix(trimmed, []byte("{")) {
+			return s.formatMismatch("it is not a JSON object")
+		}
+	case FormatCrawlerUserAgents:
+		if !bytes.HasPrefix(trimmed, []byte("[")) {
+			return s.formatMismatch("it is not a JSON array")
+		}
+	case FormatRobotsTxt:
+		if !regexp.MustCompile(regexUserAgent).Match(content) {
+			return s.formatMismatch("it has no User-agent lines")
+		}
+	case FormatNginx:
+		if !regexp.MustCompile(regexNginxMap).Match(content) && !regexp.MustCompile(regexNginxEntry).Match(content) {
+			return s.formatMismatch("it has no map block or regex entries")
+		}
+	case FormatApache:
+		if !regexp.MustCompile(regexApacheUserAgent).Match(content) {
+			return s.formatMismatch("it has no User-Agent conditions")
+		}
+	case FormatPlaintext:
+		if bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("<")) {
+			return s.formatMismatch("it appears to be JSON or markup")
+		}
+	default:
+		return fmt.Errorf("source '%s' declares unknown format '%s'", s.URL, s.Format)
+	}
+	return nil
+}
+
+func (s *Source) formatMismatch(reason string) error {
+	return fmt.Errorf("content from '%s' does not match its declared format '%s': %s", s.URL, s.Format, reason)
+}
@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestSourceDeclaredFormat tests that a declared format is used instead of detection, and that content not matching it is rejected
+func TestSourceDeclaredFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		contentType string
+		content     string
+		want        []string
+		valid       bool
+	}{
+		{name: "JSONAsTextPlain", format: FormatRobotsJSON, contentType: "text/plain; charset=utf-8", content: `{"MyBot": {"operator": "a", "respect": "b", "function": "c", "frequency": "d", "description": "e"}}`, want: []string{"MyBot"}, valid: true},
+		{name: "JSONMismatch", format: FormatRobotsJSON, content: "MyBot\nOtherBot\n"},
+		{name: "RobotsTxt", format: FormatRobotsTxt, content: "User-agent: MyBot\nDisallow: /\n", want: []string{"MyBot"}, valid: true},
+		{name: "RobotsTxtBOM", format: FormatRobotsTxt, content: "\ufeffUser-agent: MyBot\r\nDisallow: /\r\n", want: []string{"MyBot"}, valid: true},
+		{name: "RobotsTxtMismatch", format: FormatRobotsTxt, content: "MyBot\nOtherBot\n"},
+		// sniffing would treat this as a robots.txt, and find only one bot
+		{name: "PlaintextWithUserAgentLine", format: FormatPlaintext, content: "User-agent: MyBot\nOtherBot\n", want: []string{"User-agent: MyBot", "OtherBot"}, valid: true},
+		{name: "PlaintextMismatch", format: FormatPlaintext, content: "<html><body>Not Found</body></html>"},
+		{name: "CrawlerUserAgents", format: FormatCrawlerUserAgents, content: `[{"pattern": "MyBot\\/[0-9]"}]`, want: []string{`MyBot\/[0-9]`}, valid: true},
+		{name: "CrawlerUserAgentsMismatch", format: FormatCrawlerUserAgents, content: `{"MyBot": {}}`},
+		{name: "NginxMismatch", format: FormatNginx, content: "User-agent: MyBot\nDisallow: /\n"},
+		{name: "ApacheMismatch", format: FormatApache, content: "RewriteCond %{HTTP_REFERER} spam [NC]\n"},
+		{name: "Unknown", format: "YAML", content: "MyBot\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				_, _ = w.Write([]byte(tt.content))
+			}))
+			defer serv.Close()
+
+			s := &Source{URL: serv.URL, Format: tt.format}
+			i, err := s.GetIndex()
+			if !tt.valid {
+				if err == nil || !strings.Contains(err.Error(), "format") {
+					t.Errorf("expected a format error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(i) != len(tt.want) {
+				t.Errorf("expected bots %v, got %v", tt.want, i)
+			}
+			for _, w := range tt.want {
+				if _, ok := i[w]; !ok {
+					t.Errorf("expected bot '%s' in index, got %v", w, i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxSignatureSize limits how much of a detached signature response is read.
+const maxSignatureSize = 1024
+
+var (
+	errIntegrity = errors.New("source failed integrity verification")
+)
+
+// readResponse reads the retrieved content in full, and checks it against the source's pinned checksum, signature, and declared format, if configured.
+// The response body is replaced with the content read, so it can still be parsed.
+func (s *Source) readResponse() error {
+	content, err := io.ReadAll(s.response.Body)
+	_ = s.response.Body.Close()
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return fmt.Errorf("content from '%s' exceeds the maximum size of %d bytes", s.URL, maxErr.Limit)
+		}
+		return err
+	}
+	s.response.Body = io.NopCloser(bytes.NewReader(content))
+
+	if s.SHA256 != "" {
+		sum := sha256.Sum256(content)
+		if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(s.SHA256))) != 1 {
+			return fmt.Errorf("%w: SHA-256 of content from '%s' is '%x'", errIntegrity, s.URL, sum)
+		}
+	}
+	if s.PublicKey != "" {
+		err = s.verifySignature(content)
+		if err != nil {
+			return err
+		}
+	}
+	return s.checkFormat(content)
+}
+
+// verifySignature retrieves the detached ed25519 signature of the source, and verifies the content against it.
+func (s *Source) verifySignature(content []byte) error {
+	key, err := base64.StdEncoding.DecodeString(s.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: public key for '%s' is not a base64 encoded ed25519 key", errIntegrity, s.URL)
+	}
+	sig, err := s.getSignature()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), content, sig) {
+		return fmt.Errorf("%w: signature of content from '%s' is not valid", errIntegrity, s.URL)
+	}
+	return nil
+}
+
+// getSignature retrieves the detached signature of the source, from its SignatureURL or the source URL with a '.sig' suffix.
+// The signature may be raw or base64 encoded.
+func (s *Source) getSignature() ([]byte, error) {
+	u := s.SignatureURL
+	if u == "" {
+		u = s.URL + ".sig"
+	}
+	resp, err := s.get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error retrieving signature from '%s'. Status: %s", u, resp.Status)
+	}
+	sig, err := io.ReadAll(io.LimitReader(resp.Body, maxSignatureSize))
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) == ed25519.SignatureSize {
+		return sig, nil
+	}
+	dec, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || len(dec) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: signature from '%s' is not a raw or base64 encoded ed25519 signature", errIntegrity, u)
+	}
+	return dec, nil
+}
@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSignedServer is a helper function to return a test server serving a robots.txt, and its detached signature at the '.sig' suffix
+func newSignedServer(t *testing.T, content string, sig []byte) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt.sig" {
+			_, _ = w.Write(sig)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// TestSourceIntegrity tests that sources are only parsed when their content matches the pinned checksum and signature
+func TestSourceIntegrity(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(exampleSourceRobotsTxt))
+	sig := ed25519.Sign(priv, []byte(exampleSourceRobotsTxt))
+
+	tests := []struct {
+		name      string
+		sha       string
+		publicKey []byte
+		sig       []byte
+		valid     bool
+	}{
+		{name: "Checksum", sha: hex.EncodeToString(sum[:]), valid: true},
+		{name: "BadChecksum", sha: hex.EncodeToString(make([]byte, sha256.Size))},
+		{name: "RawSignature", publicKey: pub, sig: sig, valid: true},
+		{name: "Base64Signature", publicKey: pub, sig: []byte(base64.StdEncoding.EncodeToString(sig) + "\n"), valid: true},
+		{name: "WrongKey", publicKey: otherPub, sig: sig},
+		{name: "MalformedSignature", publicKey: pub, sig: []byte("not a signature")},
+		{name: "ChecksumAndSignature", sha: hex.EncodeToString(sum[:]), publicKey: pub, sig: sig, valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv := newSignedServer(t, exampleSourceRobotsTxt, tt.sig)
+			s := &Source{URL: serv.URL + "/robots.txt", SHA256: tt.sha}
+			if tt.publicKey != nil {
+				s.PublicKey = base64.StdEncoding.EncodeToString(tt.publicKey)
+			}
+			i, err := s.GetIndex()
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("unexpected error retrieving verified source: %s", err)
+				}
+				if _, ok := i["MyBot"]; !ok {
+					t.Errorf("expected verified source to be parsed, got %v", i)
+				}
+				return
+			}
+			if err == nil {
+				t.Error("expected source failing verification to return an error")
+			}
+		})
+	}
+}
+
+// TestSourceSignatureHeaders tests that the source's headers are sent for a signature on the same host, but not to another host
+func TestSourceSignatureHeaders(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := ed25519.Sign(priv, []byte(exampleSourceRobotsTxt))
+	var gotAuth, gotHeader string
+	sigServ := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotHeader = r.Header.Get("X-Team")
+		_, _ = w.Write(sig)
+	}))
+	defer sigServ.Close()
+	serv := newSignedServer(t, exampleSourceRobotsTxt, sig)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	err = os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the servers listen on different ports of the same address, so are different hosts
+	for _, tt := range []struct {
+		name    string
+		url     string
+		headers bool
+	}{
+		{name: "SameHost", url: sigServ.URL + "/robots.txt", headers: true},
+		{name: "OtherHost", url: serv.URL + "/robots.txt"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			gotAuth, gotHeader = "", ""
+			s := &Source{
+				URL:             tt.url,
+				PublicKey:       base64.StdEncoding.EncodeToString(pub),
+				SignatureURL:    sigServ.URL + "/robots.txt.sig",
+				Headers:         map[string]string{"X-Team": "bots"},
+				BearerTokenFile: tokenFile,
+			}
+			_, err := s.getSignature()
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantAuth, wantHeader := "", ""
+			if tt.headers {
+				wantAuth, wantHeader = "Bearer s3cret", "bots"
+			}
+			if gotAuth != wantAuth || gotHeader != wantHeader {
+				t.Errorf("expected Authorization '%s' and X-Team '%s', got '%s' and '%s'", wantAuth, wantHeader, gotAuth, gotHeader)
+			}
+		})
+	}
+}
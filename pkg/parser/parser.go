@@ -11,19 +11,22 @@ import (
 	"net/http"
 	"reflect"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 )
 
 const (
-	regexUserAgent    = `(?im)(?:^user-agent\s?:\s?)(.*)$`
-	regexAllowRule    = `(?im)(?:^allow\s?:\s?)(.*)$`
-	regexDisallowRule = `(?im)(?:^disallow\s?:\s?)(.*)$`
+	regexUserAgent = `(?im)(?:^\x{feff}?\s*user-agent\s*:\s*)(.*)$`
 	// while RFC 9309 says only letters, _, and - are allowed, in the wild we see almost any non-newline characters.
 	regexProductToken = `(?i)(^[^\n\r]+$)` //nolint:gosec
 
-	contentRobotsJSON = "robots.json"
-	contentRobotsTxt  = "robots.txt"
-	contentPlaintext  = "plaintext"
+	contentRobotsJSON        = FormatRobotsJSON
+	contentRobotsTxt         = FormatRobotsTxt
+	contentPlaintext         = FormatPlaintext
+	contentCrawlerUserAgents = FormatCrawlerUserAgents
+	contentNginx             = FormatNginx
+	contentApache            = FormatApache
 )
 
 // BotMetadata holds metadata about a bot's user agent. Populated from a JSON source.
@@ -37,9 +40,16 @@ type botMetadata struct {
 
 // BotUserAgent holds the fields associated with a bot's user agent.
 type BotUserAgent struct {
-	DisallowPath []string
-	AllowPath    []string
-	JSONMetadata botMetadata
+	DisallowPath    []string
+	AllowPath       []string
+	JSONMetadata    botMetadata
+	CrawlerMetadata crawlerMetadata
+	// Pattern is set for bots defined by a regular expression, rather than a name to be found in the User-Agent.
+	Pattern *regexp.Regexp
+	// CrawlDelay is the delay between requests the bot is asked to keep to by a robots.txt source. Zero if unset.
+	CrawlDelay time.Duration
+	// Source is the URL of the source the bot was retrieved from.
+	Source string
 }
 
 // RobotsIndex is a hash of bot user agents and associated data with each.
@@ -47,14 +57,35 @@ type RobotsIndex map[string]BotUserAgent
 
 // batchEntry represents a logical entry from a robots.txt file.
 type batchEntry struct {
-	ua       []string
-	allow    []string
-	disallow []string
+	ua         []string
+	allow      []string
+	disallow   []string
+	crawlDelay time.Duration
 }
 
 // Source represents a location that content will be retrieved from to populate a RobotsIndex.
 type Source struct {
-	URL         string
+	URL string
+	// SHA256 pins the hex encoded SHA-256 checksum of the content.
+	SHA256 string
+	// PublicKey is a base64 encoded ed25519 key, used to verify a detached signature of the content.
+	PublicKey string
+	// SignatureURL locates the detached signature. Defaults to the URL with a '.sig' suffix.
+	SignatureURL string
+	// Client is used to request the source. Defaults to a client with DefaultTimeout.
+	Client *http.Client
+	// ClientOptions are the options Client was built with. Sources are only shared through a SourcePool between consumers with the same options.
+	ClientOptions ClientOptions
+	// Headers are set on each request for the source.
+	Headers map[string]string
+	// BearerTokenFile holds a token sent in the Authorization header of each request for the source.
+	BearerTokenFile string
+	// MaxSize limits the size of the content in bytes. Defaults to DefaultMaxSize.
+	MaxSize int64
+	// Format declares the format of the content. If empty, it is detected from the response.
+	Format string
+	// Warnings holds the problems found parsing the content, such as entries that were skipped. Set by GetIndex.
+	Warnings    []RobotsWarning
 	response    *http.Response
 	contentType string
 }
@@ -62,6 +93,7 @@ type Source struct {
 // GetIndex retrieves the content from a source URL, and returns a RobotsIndex of the content.
 func (s *Source) GetIndex() (RobotsIndex, error) {
 	i := make(RobotsIndex)
+	s.Warnings = nil
 	err := s.getContent()
 	if err != nil {
 		return i, err
@@ -70,23 +102,35 @@ func (s *Source) GetIndex() (RobotsIndex, error) {
 	if s.response.StatusCode != http.StatusOK {
 		return i, fmt.Errorf("error retrieving source data from '%s'. Status: %s", s.URL, s.response.Status)
 	}
+	err = s.readResponse()
+	if err != nil {
+		return i, err
+	}
 	i, err = s.getIndexFromContent()
+	for k, v := range i {
+		v.Source = s.URL
+		i[k] = v
+	}
 	return i, err
 }
 
+// addTxtRule adds the paths of a robots.txt entry to each of its user-agents, combining them with any paths from earlier entries.
 func (r *RobotsIndex) addTxtRule(e batchEntry) {
 	for _, u := range e.ua {
-		(*r)[u] = BotUserAgent{AllowPath: e.allow, DisallowPath: e.disallow}
+		b := (*r)[u]
+		b.AllowPath = append(slices.Clip(b.AllowPath), e.allow...)
+		b.DisallowPath = append(slices.Clip(b.DisallowPath), e.disallow...)
+		// when the user-agent has several groups, honor the longest delay asked of it
+		if e.crawlDelay > b.CrawlDelay {
+			b.CrawlDelay = e.crawlDelay
+		}
+		(*r)[u] = b
 	}
 }
 
 func (s *Source) getContent() error {
-	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
-	if err != nil {
-		return err
-	}
-
-	s.response, err = http.DefaultClient.Do(req)
+	var err error
+	s.response, err = s.get(s.URL)
 	return err
 }
 
@@ -98,7 +142,11 @@ func (s *Source) getContentType() (*bufio.Reader, error) {
 	sniff := s.response.Header.Get("X-Content-Type-Options") != "nosniff"
 	u := s.response.Request.URL.String()
 	if s.response.Header.Get("Content-Type") == mime.TypeByExtension(".json") || strings.HasSuffix(u, ".json") {
+		// a JSON array is a crawler-user-agents.json list, rather than a robots.json object
 		s.contentType = contentRobotsJSON
+		if firstJSONByte(bR) == '[' {
+			s.contentType = contentCrawlerUserAgents
+		}
 		return bR, err
 	}
 	if sniff {
@@ -109,21 +157,61 @@ func (s *Source) getContentType() (*bufio.Reader, error) {
 				s.contentType = contentRobotsJSON
 				return bR, err
 			}
+			if string(firstC) == "[" {
+				s.contentType = contentCrawlerUserAgents
+				return bR, err
+			}
 		}
 	}
-	// look for user-agent directive as hint this is robots.txt
+	return s.sniffFormat(bR), err
+}
+
+// formatHint is a line that hints at the format of content.
+type formatHint struct {
+	contentType string
+	re          *regexp.Regexp
+}
+
+// sniffFormat looks for lines hinting at the format of content: a user-agent directive for robots.txt,
+// or web server config matching the user-agent. When the content has lines matching several hints, the one earliest in
+// the order of precedence wins, regardless of where in the content it is. Web server config takes precedence over robots.txt,
+// since it may embed robots.txt lines, such as in a location serving one. The content is plain text if nothing matches.
+func (s *Source) sniffFormat(bR *bufio.Reader) *bufio.Reader {
+	hints := []formatHint{
+		{contentType: contentNginx, re: regexp.MustCompile(regexNginxMap)},
+		{contentType: contentApache, re: regexp.MustCompile(regexApacheUserAgent)},
+		{contentType: contentRobotsTxt, re: regexp.MustCompile(regexUserAgent)},
+	}
 	buf := &bytes.Buffer{}
 	tee := io.TeeReader(bR, buf)
-	re := regexp.MustCompile(regexUserAgent)
-	bT := bufio.NewReader(buf)
 	bS := bufio.NewScanner(tee)
-	for bS.Scan() {
-		if re.MatchString(bS.Text()) {
-			s.contentType = contentRobotsTxt
-			break
+	bS.Buffer(nil, webServerMaxLine)
+	best := len(hints)
+	// stop early once the hint with the highest precedence matches, since nothing can override it
+	for best > 0 && bS.Scan() {
+		for i := 0; i < best; i++ { //nolint:intrange,modernize
+			if hints[i].re.MatchString(bS.Text()) {
+				best = i
+				break
+			}
 		}
 	}
-	return bT, err
+	if best < len(hints) {
+		s.contentType = hints[best].contentType
+	}
+	// the scanner may stop early, so pick up the content it didn't read after what it did
+	return bufio.NewReader(io.MultiReader(buf, bR))
+}
+
+// firstJSONByte returns the first byte of the content that isn't whitespace, without consuming the reader.
+func firstJSONByte(r *bufio.Reader) byte {
+	// Peek returns what it could along with an error for short content, which is fine to inspect
+	b, _ := r.Peek(512)
+	b = bytes.TrimLeft(bytes.TrimPrefix(b, []byte("\ufeff")), " \t\r\n")
+	if len(b) == 0 {
+		return 0
+	}
+	return b[0]
 }
 
 func (s *Source) getIndexFromContent() (RobotsIndex, error) {
@@ -131,6 +219,9 @@ func (s *Source) getIndexFromContent() (RobotsIndex, error) {
 	var bR *bufio.Reader
 	var err error
 
+	if s.Format != "" {
+		s.contentType = s.Format
+	}
 	if s.contentType == "" {
 		bR, err = s.getContentType()
 		if err != nil {
@@ -143,8 +234,14 @@ func (s *Source) getIndexFromContent() (RobotsIndex, error) {
 	switch s.contentType {
 	case contentRobotsJSON:
 		rIndex, err = robotsJSONParse(bR)
+	case contentCrawlerUserAgents:
+		rIndex, s.Warnings, err = crawlerUserAgentsParse(bR)
 	case contentRobotsTxt:
 		rIndex = robotsTxtParse(bR)
+	case contentNginx:
+		rIndex, err = nginxMapParse(bR)
+	case contentApache:
+		rIndex, err = apacheParse(bR)
 	case contentPlaintext:
 		rIndex = robotsPlaintextParse(bR)
 	}
@@ -153,50 +250,7 @@ func (s *Source) getIndexFromContent() (RobotsIndex, error) {
 }
 
 func robotsTxtParse(r *bufio.Reader) RobotsIndex {
-	s := bufio.NewScanner(r)
-	rIndex := make(RobotsIndex)
-
-	// rfc9309. user-agent statement(s) precede any amount of rules, before starting another entry
-	var e batchEntry
-	ua := false
-	rule := false
-	reUa := regexp.MustCompile(regexUserAgent)
-	reAllow := regexp.MustCompile(regexAllowRule)
-	reDisallow := regexp.MustCompile(regexDisallowRule)
-	for s.Scan() {
-		l := s.Text()
-		switch {
-		case (ua || rule) && reAllow.MatchString(l):
-			ua = false
-			rule = true
-			m := reAllow.FindStringSubmatch(l)
-			e.allow = append(e.allow, m[1])
-		case (ua || rule) && reDisallow.MatchString(l):
-			ua = false
-			rule = true
-			m := reDisallow.FindStringSubmatch(l)
-			e.disallow = append(e.disallow, m[1])
-		default:
-			if rule {
-				rIndex.addTxtRule(e)
-				e = batchEntry{}
-			}
-			uM := reUa.FindStringSubmatch(l)
-			if len(uM) > 0 {
-				ua = true
-				rule = false
-				e.ua = append(e.ua, uM[1])
-			} else {
-				ua = false
-				rule = false
-			}
-		}
-	}
-	if rule {
-		rIndex.addTxtRule(e)
-	}
-
-	return rIndex
+	return ParseRobotsTxt(r).Index()
 }
 
 func robotsPlaintextParse(r *bufio.Reader) RobotsIndex {
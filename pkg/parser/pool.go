@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pooledSource is a source shared between consumers, along with the last index successfully retrieved from it.
+type pooledSource struct {
+	fetched time.Time
+	index   RobotsIndex
+	lock    sync.Mutex
+	source  Source
+	url     string
+}
+
+// SourcePool shares sources between multiple consumers, so that a source used by several of them is only retrieved once.
+type SourcePool struct {
+	lock    sync.Mutex
+	sources map[string]*pooledSource
+}
+
+// NewSourcePool creates an empty SourcePool.
+func NewSourcePool() *SourcePool {
+	return &SourcePool{
+		sources: make(map[string]*pooledSource),
+	}
+}
+
+// poolKey identifies a source in the pool. Besides the URL, anything that changes how the source is requested, verified, or parsed,
+// including the options of its HTTP client, must be part of the key, so that a consumer never gets an index retrieved under another consumer's options.
+func poolKey(src Source) string {
+	headers := make([]string, 0, len(src.Headers))
+	for k, v := range src.Headers {
+		headers = append(headers, strconv.Quote(k)+":"+strconv.Quote(v))
+	}
+	sort.Strings(headers)
+	o := src.ClientOptions.withDefaults()
+	return strings.Join([]string{
+		strconv.Quote(src.URL), src.Format, src.SHA256, src.PublicKey, strconv.Quote(src.SignatureURL),
+		strconv.Quote(src.BearerTokenFile), strconv.FormatInt(src.MaxSize, 10), strings.Join(headers, ","),
+		strconv.Quote(o.CAFile), strconv.Quote(o.ProxyURL), o.ConnectTimeout.String(), o.Timeout.String(),
+	}, "|")
+}
+
+// GetIndex returns the RobotsIndex of the provided source, retrieving it only if no consumer has done so within maxAge.
+// Sources are shared by URL, along with their format, integrity checks, request options, and client options. The returned index is shared, and must not be modified.
+// Any warnings from parsing the source are only returned to the consumer that retrieved it, so that they're reported once.
+func (p *SourcePool) GetIndex(src Source, maxAge time.Duration) (RobotsIndex, []RobotsWarning, error) {
+	p.lock.Lock()
+	k := poolKey(src)
+	s, ok := p.sources[k]
+	if !ok {
+		s = &pooledSource{url: src.URL}
+		p.sources[k] = s
+	}
+	p.lock.Unlock()
+
+	// holding the source's lock while retrieving it means concurrent consumers wait for one request, rather than each making their own
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.index != nil && time.Since(s.fetched) < maxAge {
+		return s.index, nil, nil
+	}
+	s.source = src
+	i, err := s.source.GetIndex()
+	if err != nil {
+		// don't keep a failed result around, the next consumer should try again
+		return i, s.source.Warnings, err
+	}
+	s.index = i
+	s.fetched = time.Now()
+	return i, s.source.Warnings, nil
+}
+
+// Invalidate discards every index retrieved from the source at the provided URL, so that the next consumer retrieves it again.
+func (p *SourcePool) Invalidate(u string) {
+	p.lock.Lock()
+	var matched []*pooledSource
+	for _, s := range p.sources {
+		if s.url == u {
+			matched = append(matched, s)
+		}
+	}
+	p.lock.Unlock()
+	for _, s := range matched {
+		s.lock.Lock()
+		s.fetched = time.Time{}
+		s.lock.Unlock()
+	}
+}
@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestSourcePoolKey tests that a source is only shared between consumers requesting, verifying, and parsing it the same way
+func TestSourcePoolKey(t *testing.T) {
+	requests := 0
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		_, _ = w.Write([]byte("User-agent: MyBot\nDisallow: /\n"))
+	}))
+	defer serv.Close()
+	p := NewSourcePool()
+
+	txt, _, err := p.GetIndex(Source{URL: serv.URL, Format: FormatRobotsTxt}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _ = p.GetIndex(Source{URL: serv.URL, Format: FormatRobotsTxt}, time.Hour)
+	if requests != 1 {
+		t.Errorf("expected a source with the same options to be shared, got %d requests", requests)
+	}
+
+	plain, _, err := p.GetIndex(Source{URL: serv.URL, Format: FormatPlaintext}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := txt["MyBot"]; !ok || len(plain) != 2 {
+		t.Errorf("expected each format to be parsed separately, got %v and %v", txt, plain)
+	}
+	_, _, _ = p.GetIndex(Source{URL: serv.URL, Format: FormatRobotsTxt, Headers: map[string]string{"X-Api-Key": "secret"}}, time.Hour)
+	_, _, err = p.GetIndex(Source{URL: serv.URL, Format: FormatRobotsTxt, SHA256: "0000"}, time.Hour)
+	if err == nil {
+		t.Error("expected a pinned checksum to be verified, rather than an unpinned index being shared")
+	}
+	if requests != 4 {
+		t.Errorf("expected sources with other formats, headers, or pins to be retrieved separately, got %d requests", requests)
+	}
+
+	_, _, _ = p.GetIndex(Source{URL: serv.URL, Format: FormatRobotsTxt, ClientOptions: ClientOptions{Timeout: DefaultTimeout}}, time.Hour)
+	if requests != 4 {
+		t.Errorf("expected a source with the default client options spelled out to be shared, got %d requests", requests)
+	}
+	_, _, _ = p.GetIndex(Source{URL: serv.URL, Format: FormatRobotsTxt, ClientOptions: ClientOptions{ProxyURL: "http://proxy.example.com"}}, time.Hour)
+	_, _, _ = p.GetIndex(Source{URL: serv.URL, Format: FormatRobotsTxt, ClientOptions: ClientOptions{Timeout: time.Minute}}, time.Hour)
+	if requests != 6 {
+		t.Errorf("expected sources with other client options to be retrieved separately, got %d requests", requests)
+	}
+
+	p.Invalidate(serv.URL)
+	_, _, _ = p.GetIndex(Source{URL: serv.URL, Format: FormatRobotsTxt}, time.Hour)
+	_, _, _ = p.GetIndex(Source{URL: serv.URL, Format: FormatPlaintext}, time.Hour)
+	if requests != 8 {
+		t.Errorf("expected every source for the URL to be invalidated, got %d requests", requests)
+	}
+}
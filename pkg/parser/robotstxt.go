@@ -0,0 +1,389 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsMaxCrawlDelay is the longest crawl-delay accepted, longer ones are limited to it.
+const robotsMaxCrawlDelay = 24 * time.Hour
+
+// RobotsTxt is a structured representation of a robots.txt file, as described by RFC 9309.
+type RobotsTxt struct {
+	Groups   []RobotsGroup
+	Sitemaps []string
+	// Directives holds any unrecognized lines that appear before the first group.
+	Directives []RobotsDirective
+	// Warnings holds the problems found while parsing, such as lines that were ignored.
+	Warnings []RobotsWarning
+}
+
+// RobotsGroup is a set of rules that apply to one or more user-agents.
+type RobotsGroup struct {
+	UserAgents []string
+	Rules      []RobotsRule
+	// CrawlDelay is the non-standard delay asked of the group's user-agents between requests. Zero if unset.
+	CrawlDelay time.Duration
+	// Directives holds any unrecognized lines within the group, such as those specific to one search engine.
+	Directives []RobotsDirective
+}
+
+// RobotsRule is a single allow or disallow rule of a group.
+type RobotsRule struct {
+	Allow bool
+	Path  string
+}
+
+// RobotsDirective is a line of a robots.txt that isn't part of RFC 9309, or a widely supported extension of it.
+type RobotsDirective struct {
+	Name  string
+	Value string
+}
+
+// RobotsWarning describes a problem with a line of a robots.txt.
+type RobotsWarning struct {
+	Line    int
+	Message string
+}
+
+// String formats the warning along with its line number.
+func (w RobotsWarning) String() string {
+	return fmt.Sprintf("line %d: %s", w.Line, w.Message)
+}
+
+// robotsTxtParser holds the state of a robots.txt while it's parsed line by line.
+type robotsTxtParser struct {
+	rTxt *RobotsTxt
+	cur  *RobotsGroup
+	// inUserAgents is set while reading the user-agent lines that start a group. Any other line of a group ends them.
+	inUserAgents bool
+	line         int
+	// seen tracks the line each user-agent's group started on, to report user-agents with several groups
+	seen map[string]int
+}
+
+// ParseRobotsTxt reads a robots.txt file into its groups, sitemaps, and any other directives.
+// Lines may end in CR, LF, or CRLF, and a leading byte order mark is ignored. Problems with the file are reported in its Warnings, rather than failing the parse,
+// since crawlers are expected to make the best of whatever they're served.
+func ParseRobotsTxt(r io.Reader) *RobotsTxt {
+	p := &robotsTxtParser{rTxt: &RobotsTxt{}, seen: make(map[string]int)}
+	s := bufio.NewScanner(r)
+	s.Split(scanRobotsLines)
+	for s.Scan() {
+		p.line++
+		p.parseLine(s.Text())
+	}
+	if err := s.Err(); err != nil {
+		p.warn("could not read the rest of the file: " + err.Error())
+	}
+	p.endGroup()
+	return p.rTxt
+}
+
+// scanRobotsLines is a bufio.SplitFunc like bufio.ScanLines, which also splits on a lone CR.
+func scanRobotsLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	i := bytes.IndexAny(data, "\r\n")
+	switch {
+	case i < 0 && atEOF:
+		return len(data), data, nil
+	case i < 0:
+		return 0, nil, nil
+	case data[i] == '\n':
+		return i + 1, data[:i], nil
+	case i+1 < len(data) && data[i+1] == '\n':
+		return i + 2, data[:i], nil
+	case i+1 == len(data) && !atEOF:
+		// need more data to tell a CRLF from a lone CR
+		return 0, nil, nil
+	default:
+		return i + 1, data[:i], nil
+	}
+}
+
+func (p *robotsTxtParser) warn(m string) {
+	p.rTxt.Warnings = append(p.rTxt.Warnings, RobotsWarning{Line: p.line, Message: m})
+}
+
+// parseLine parses a `key: value` line, dropping any comment.
+func (p *robotsTxtParser) parseLine(l string) {
+	if p.line == 1 {
+		l = strings.TrimPrefix(l, "\ufeff")
+	}
+	if i := strings.IndexByte(l, '#'); i >= 0 {
+		l = l[:i]
+	}
+	l = strings.TrimSpace(l)
+	if l == "" {
+		return
+	}
+	k, v, ok := strings.Cut(l, ":")
+	if !ok {
+		p.warn("no ':' separating the directive from its value, ignoring the line")
+		return
+	}
+	k = strings.TrimSpace(k)
+	v = strings.TrimSpace(v)
+	switch strings.ToLower(k) {
+	case "user-agent":
+		p.userAgent(v)
+	case "allow":
+		p.rule(true, v)
+	case "disallow":
+		p.rule(false, v)
+	case "sitemap":
+		// sitemaps aren't tied to any group, and may appear anywhere
+		if v == "" {
+			p.warn("empty sitemap, ignoring the line")
+			return
+		}
+		p.rTxt.Sitemaps = append(p.rTxt.Sitemaps, v)
+	case "crawl-delay":
+		p.crawlDelay(v)
+	default:
+		p.directive(k, v)
+	}
+}
+
+// userAgent adds a user-agent to the current group, or starts a new group if the previous line ended the user-agents of the current one.
+func (p *robotsTxtParser) userAgent(v string) {
+	if v == "" {
+		p.warn("empty user-agent, ignoring the line")
+		return
+	}
+	if !p.inUserAgents {
+		p.endGroup()
+		p.cur = &RobotsGroup{}
+		p.inUserAgents = true
+	}
+	p.cur.UserAgents = append(p.cur.UserAgents, v)
+	u := strings.ToLower(v)
+	if l, ok := p.seen[u]; ok {
+		p.warn(fmt.Sprintf("user-agent '%s' already has a group starting on line %d, their rules will be combined", v, l))
+	} else {
+		p.seen[u] = p.line
+	}
+}
+
+// member returns the current group for a line that belongs to one, or nil if the line came before any user-agent.
+func (p *robotsTxtParser) member(name string) *RobotsGroup {
+	if p.cur == nil {
+		p.warn(name + " before any user-agent, ignoring the line")
+		return nil
+	}
+	p.inUserAgents = false
+	return p.cur
+}
+
+func (p *robotsTxtParser) rule(allow bool, v string) {
+	g := p.member("rule")
+	if g == nil {
+		return
+	}
+	// an empty path is a rule that matches nothing, commonly used to allow everything
+	if v != "" && !strings.HasPrefix(v, "/") && !strings.HasPrefix(v, "*") {
+		p.warn("path '" + v + "' should start with '/'")
+	}
+	g.Rules = append(g.Rules, RobotsRule{Allow: allow, Path: v})
+}
+
+func (p *robotsTxtParser) crawlDelay(v string) {
+	g := p.member("crawl-delay")
+	if g == nil {
+		return
+	}
+	d, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(d) || math.IsInf(d, 0) || d < 0 {
+		p.warn("crawl-delay '" + v + "' is not a number of seconds, ignoring the line")
+		return
+	}
+	if d > robotsMaxCrawlDelay.Seconds() {
+		p.warn("crawl-delay '" + v + "' is longer than " + robotsMaxCrawlDelay.String() + ", limiting it to that")
+		d = robotsMaxCrawlDelay.Seconds()
+	}
+	g.CrawlDelay = time.Duration(d * float64(time.Second))
+}
+
+// directive keeps a line that isn't otherwise understood, so that it survives rendering the file again.
+func (p *robotsTxtParser) directive(k string, v string) {
+	p.warn("unrecognized directive '" + k + "'")
+	d := RobotsDirective{Name: k, Value: v}
+	if p.cur == nil {
+		p.rTxt.Directives = append(p.rTxt.Directives, d)
+		return
+	}
+	p.inUserAgents = false
+	p.cur.Directives = append(p.cur.Directives, d)
+}
+
+func (p *robotsTxtParser) endGroup() {
+	if p.cur != nil {
+		p.rTxt.Groups = append(p.rTxt.Groups, *p.cur)
+		p.cur = nil
+	}
+	p.inUserAgents = false
+}
+
+// Index converts the groups of the robots.txt into a RobotsIndex, keyed by user-agent.
+// As RFC 9309 requires, the rules of every group for a user-agent are combined, matching user-agents case-insensitively.
+func (r *RobotsTxt) Index() RobotsIndex {
+	rIndex := make(RobotsIndex)
+	// the index is keyed by the first spelling of each user-agent
+	names := make(map[string]string)
+	for _, g := range r.Groups {
+		e := batchEntry{crawlDelay: g.CrawlDelay}
+		for _, u := range g.UserAgents {
+			n, ok := names[strings.ToLower(u)]
+			if !ok {
+				n = u
+				names[strings.ToLower(u)] = u
+			}
+			e.ua = append(e.ua, n)
+		}
+		for _, rule := range g.Rules {
+			if rule.Allow {
+				e.allow = append(e.allow, rule.Path)
+			} else {
+				e.disallow = append(e.disallow, rule.Path)
+			}
+		}
+		rIndex.addTxtRule(e)
+	}
+	return rIndex
+}
+
+// Merge combines the groups, sitemaps, and directives of another robots.txt into this one.
+// The other robots.txt takes precedence: any user-agent it has a group for is removed from this robots.txt's groups first.
+// The exception is the `*` user-agent, which applies to every crawler. As RFC 9309 combines groups for the same user-agent,
+// the rules of the other robots.txt's `*` group are added to this one's, rather than replacing them, unless it disallows everything.
+func (r *RobotsTxt) Merge(o *RobotsTxt) {
+	var oUA []string
+	var wildcard []RobotsGroup
+	others := make([]RobotsGroup, 0, len(o.Groups))
+	for _, g := range o.Groups {
+		if isWildcardGroup(g) {
+			wildcard = append(wildcard, g)
+			continue
+		}
+		others = append(others, g)
+		for _, u := range g.UserAgents {
+			if u != "*" {
+				oUA = append(oUA, strings.ToLower(u))
+			}
+		}
+	}
+
+	groups := make([]RobotsGroup, 0, len(r.Groups)+len(others))
+	for _, g := range r.Groups {
+		var keep []string
+		for _, u := range g.UserAgents {
+			if !slices.Contains(oUA, strings.ToLower(u)) {
+				keep = append(keep, u)
+			}
+		}
+		if len(keep) > 0 {
+			g.UserAgents = keep
+			groups = append(groups, g)
+		}
+	}
+	r.Groups = append(groups, others...)
+	for _, g := range wildcard {
+		r.mergeWildcard(g)
+	}
+
+	for _, s := range o.Sitemaps {
+		if !slices.Contains(r.Sitemaps, s) {
+			r.Sitemaps = append(r.Sitemaps, s)
+		}
+	}
+	for _, d := range o.Directives {
+		if !slices.Contains(r.Directives, d) {
+			r.Directives = append(r.Directives, d)
+		}
+	}
+}
+
+// isWildcardGroup reports whether the group is for the `*` user-agent alone.
+func isWildcardGroup(g RobotsGroup) bool {
+	return len(g.UserAgents) == 1 && g.UserAgents[0] == "*"
+}
+
+// mergeWildcard adds the rules and directives of a `*` group to this robots.txt's `*` group, or adds the group if there isn't one.
+// If the added group disallows everything, this group's allow rules are dropped, since under RFC 9309 the longer path of an allow rule would win over it.
+func (r *RobotsTxt) mergeWildcard(o RobotsGroup) {
+	i := slices.IndexFunc(r.Groups, isWildcardGroup)
+	if i < 0 {
+		r.Groups = append(r.Groups, o)
+		return
+	}
+	g := &r.Groups[i]
+	if slices.Contains(o.Rules, RobotsRule{Path: "/"}) {
+		g.Rules = slices.DeleteFunc(g.Rules, func(rule RobotsRule) bool {
+			return rule.Allow
+		})
+	}
+	for _, rule := range o.Rules {
+		if !slices.Contains(g.Rules, rule) {
+			g.Rules = append(g.Rules, rule)
+		}
+	}
+	for _, d := range o.Directives {
+		if !slices.Contains(g.Directives, d) {
+			g.Directives = append(g.Directives, d)
+		}
+	}
+	if o.CrawlDelay > g.CrawlDelay {
+		g.CrawlDelay = o.CrawlDelay
+	}
+}
+
+// String renders the robots.txt file.
+func (r *RobotsTxt) String() string {
+	var sb strings.Builder
+	for _, d := range r.Directives {
+		sb.WriteString(d.Name + ": " + d.Value + "\n")
+	}
+	for i, g := range r.Groups {
+		if i > 0 || len(r.Directives) > 0 {
+			sb.WriteString("\n")
+		}
+		g.write(&sb)
+	}
+	if len(r.Sitemaps) > 0 {
+		if len(r.Groups) > 0 || len(r.Directives) > 0 {
+			sb.WriteString("\n")
+		}
+		for _, s := range r.Sitemaps {
+			sb.WriteString("Sitemap: " + s + "\n")
+		}
+	}
+	return sb.String()
+}
+
+func (g *RobotsGroup) write(sb *strings.Builder) {
+	for _, u := range g.UserAgents {
+		sb.WriteString("User-agent: " + u + "\n")
+	}
+	if g.CrawlDelay > 0 {
+		sb.WriteString("Crawl-delay: " + strconv.FormatFloat(g.CrawlDelay.Seconds(), 'f', -1, 64) + "\n")
+	}
+	for _, rule := range g.Rules {
+		if rule.Allow {
+			sb.WriteString("Allow: " + rule.Path + "\n")
+		} else {
+			sb.WriteString("Disallow: " + rule.Path + "\n")
+		}
+	}
+	for _, d := range g.Directives {
+		sb.WriteString(d.Name + ": " + d.Value + "\n")
+	}
+}
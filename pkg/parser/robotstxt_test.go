@@ -0,0 +1,225 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const exampleRobotsTxtApp = `User-agent: *
+Disallow: /admin/
+Allow: /admin/public
+
+Sitemap: https://example.com/sitemap.xml
+
+User-agent: GPTBot
+Allow: /
+`
+
+// TestParseRobotsTxt tests that groups, rules, and sitemaps are parsed from a robots.txt file
+func TestParseRobotsTxt(t *testing.T) {
+	r := ParseRobotsTxt(strings.NewReader(exampleRobotsTxtApp))
+	if len(r.Groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(r.Groups))
+	}
+	g := r.Groups[0]
+	if !sliceMatch(g.UserAgents, []string{"*"}) {
+		t.Errorf("expected first group for user-agent '*', got '%s'", strings.Join(g.UserAgents, ","))
+	}
+	wantRules := []RobotsRule{{Path: "/admin/"}, {Allow: true, Path: "/admin/public"}}
+	if len(g.Rules) != len(wantRules) {
+		t.Fatalf("expected %d rules in first group, got %d", len(wantRules), len(g.Rules))
+	}
+	for i, rule := range wantRules {
+		if g.Rules[i] != rule {
+			t.Errorf("expected rule %v, got %v", rule, g.Rules[i])
+		}
+	}
+	if !sliceMatch(r.Sitemaps, []string{"https://example.com/sitemap.xml"}) {
+		t.Errorf("expected sitemap to be parsed, got '%s'", strings.Join(r.Sitemaps, ","))
+	}
+}
+
+// TestRobotsTxtIndex tests that a parsed robots.txt converts into a RobotsIndex
+func TestRobotsTxtIndex(t *testing.T) {
+	i := ParseRobotsTxt(strings.NewReader(exampleSourceRobotsTxtMulti)).Index()
+	for k, want := range exampleSourceRobotsTxtMap {
+		got, ok := i[k]
+		if !ok {
+			t.Fatalf("expected User-Agent '%s' in index", k)
+		}
+		if !sliceMatch(got.AllowPath, want.AllowPath) || !sliceMatch(got.DisallowPath, want.DisallowPath) {
+			t.Errorf("index entry for '%s' did not match. Expected %v, got %v", k, want, got)
+		}
+	}
+}
+
+// TestRobotsTxtMerge tests that merging keeps upstream groups and sitemaps, while the merged-in groups take precedence per user-agent
+func TestRobotsTxtMerge(t *testing.T) {
+	r := ParseRobotsTxt(strings.NewReader(exampleRobotsTxtApp))
+	gen := ParseRobotsTxt(strings.NewReader("User-agent: gptbot\nUser-agent: ClaudeBot\nDisallow: /\n\nSitemap: https://example.com/sitemap.xml\n"))
+	r.Merge(gen)
+
+	if len(r.Groups) != 2 {
+		t.Fatalf("expected upstream GPTBot group to be replaced, leaving 2 groups. Got %d: %s", len(r.Groups), r.String())
+	}
+	if !sliceMatch(r.Groups[1].UserAgents, []string{"gptbot", "ClaudeBot"}) {
+		t.Errorf("expected merged group to be last, got '%s'", strings.Join(r.Groups[1].UserAgents, ","))
+	}
+	if len(r.Sitemaps) != 1 {
+		t.Errorf("expected duplicate sitemaps to be merged, got '%s'", strings.Join(r.Sitemaps, ","))
+	}
+}
+
+// TestRobotsTxtMergeWildcard tests that the wildcard groups of both robots.txt files are combined, rather than the merged-in one replacing the other
+func TestRobotsTxtMergeWildcard(t *testing.T) {
+	r := ParseRobotsTxt(strings.NewReader(exampleRobotsTxtApp))
+	r.Merge(ParseRobotsTxt(strings.NewReader("User-agent: *\nDisallow: /maze/\nDisallow: /admin/\n")))
+
+	want := "User-agent: *\nDisallow: /admin/\nAllow: /admin/public\nDisallow: /maze/\n\nUser-agent: GPTBot\nAllow: /\n\nSitemap: https://example.com/sitemap.xml\n"
+	if out := r.String(); out != want {
+		t.Errorf("merged robots.txt did not match. Expected:\n%s\nGot:\n%s", want, out)
+	}
+}
+
+// TestRobotsTxtMergeWildcardDisallowAll tests that a merged-in wildcard group disallowing everything isn't undone by the other robots.txt's allow rules
+func TestRobotsTxtMergeWildcardDisallowAll(t *testing.T) {
+	r := ParseRobotsTxt(strings.NewReader(exampleRobotsTxtApp))
+	r.Merge(ParseRobotsTxt(strings.NewReader("User-agent: *\nDisallow: /\n")))
+
+	want := "User-agent: *\nDisallow: /admin/\nDisallow: /\n\nUser-agent: GPTBot\nAllow: /\n\nSitemap: https://example.com/sitemap.xml\n"
+	if out := r.String(); out != want {
+		t.Errorf("merged robots.txt did not match. Expected:\n%s\nGot:\n%s", want, out)
+	}
+}
+
+// TestRobotsTxtString tests that a robots.txt renders back into a parsable file
+func TestRobotsTxtString(t *testing.T) {
+	r := ParseRobotsTxt(strings.NewReader(exampleRobotsTxtApp))
+	out := r.String()
+	want := "User-agent: *\nDisallow: /admin/\nAllow: /admin/public\n\nUser-agent: GPTBot\nAllow: /\n\nSitemap: https://example.com/sitemap.xml\n"
+	if out != want {
+		t.Errorf("rendered robots.txt did not match. Expected:\n%s\nGot:\n%s", want, out)
+	}
+	reparsed := ParseRobotsTxt(strings.NewReader(out))
+	if reparsed.String() != out {
+		t.Error("rendered robots.txt did not survive a round trip through the parser")
+	}
+}
+
+// TestParseRobotsTxtRFC9309 tests the parts of RFC 9309 that a line by line reading gets wrong: line endings, comments, and groups split across the file
+func TestParseRobotsTxtRFC9309(t *testing.T) {
+	content := "\ufeffUser-agent: MyBot # our bot\r\n" +
+		"# a comment within the group\r\n" +
+		"Disallow: /private # trailing comment\r" +
+		"Crawl-delay: 2.5\r" +
+		"  USER-AGENT :OtherBot\n" +
+		"Allow:/public\n" +
+		"Clean-param: ref /articles/\n" +
+		"\n" +
+		"user-agent: mybot\n" +
+		"disallow: /tmp\n" +
+		"Sitemap: https://example.com/sitemap.xml\n"
+	r := ParseRobotsTxt(strings.NewReader(content))
+
+	if len(r.Groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d: %+v", len(r.Groups), r.Groups)
+	}
+	g := r.Groups[0]
+	if !sliceMatch(g.UserAgents, []string{"MyBot"}) || len(g.Rules) != 1 || g.Rules[0].Path != "/private" {
+		t.Errorf("expected the BOM and comments to be dropped from the first group, got %+v", g)
+	}
+	if g.CrawlDelay != 2500*time.Millisecond {
+		t.Errorf("expected crawl-delay of 2.5s, got %s", g.CrawlDelay)
+	}
+	g = r.Groups[1]
+	if !sliceMatch(g.UserAgents, []string{"OtherBot"}) || len(g.Rules) != 1 || g.Rules[0] != (RobotsRule{Allow: true, Path: "/public"}) {
+		t.Errorf("expected a second group for OtherBot, got %+v", g)
+	}
+	if len(g.Directives) != 1 || g.Directives[0] != (RobotsDirective{Name: "Clean-param", Value: "ref /articles/"}) {
+		t.Errorf("expected the unknown directive to be kept in its group, got %+v", g.Directives)
+	}
+	if !sliceMatch(r.Sitemaps, []string{"https://example.com/sitemap.xml"}) {
+		t.Errorf("expected sitemap to be parsed, got '%s'", strings.Join(r.Sitemaps, ","))
+	}
+
+	i := r.Index()
+	if _, ok := i["mybot"]; ok || !sliceMatch(i["MyBot"].DisallowPath, []string{"/private", "/tmp"}) {
+		t.Errorf("expected the groups for MyBot to be combined, got %+v", i)
+	}
+	if i["MyBot"].CrawlDelay != 2500*time.Millisecond || i["OtherBot"].CrawlDelay != 0 {
+		t.Errorf("expected the crawl-delay to be kept for MyBot only, got %+v", i)
+	}
+
+	wantLines := []int{7, 9}
+	if len(r.Warnings) != len(wantLines) {
+		t.Fatalf("expected %d warnings, got %v", len(wantLines), r.Warnings)
+	}
+	for n, w := range r.Warnings {
+		if w.Line != wantLines[n] {
+			t.Errorf("expected warning on line %d, got %s", wantLines[n], w)
+		}
+	}
+}
+
+// TestParseRobotsTxtWarnings tests that lines which can't be understood are skipped and reported with their line number
+func TestParseRobotsTxtWarnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "RuleOutsideGroup", content: "Disallow: /\nUser-agent: MyBot\n", want: "line 1: rule before any user-agent"},
+		{name: "NoSeparator", content: "User-agent: MyBot\nDisallow /\n", want: "line 2: no ':'"},
+		{name: "EmptyUserAgent", content: "User-agent:\n", want: "line 1: empty user-agent"},
+		{name: "BadCrawlDelay", content: "User-agent: MyBot\nCrawl-delay: soon\n", want: "line 2: crawl-delay 'soon'"},
+		{name: "RelativePath", content: "User-agent: MyBot\nDisallow: private\n", want: "line 2: path 'private'"},
+		{name: "Unknown", content: "Host: example.com\n", want: "line 1: unrecognized directive 'Host'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ParseRobotsTxt(strings.NewReader(tt.content))
+			if len(r.Warnings) != 1 || !strings.HasPrefix(r.Warnings[0].String(), tt.want) {
+				t.Errorf("expected a warning starting with '%s', got %v", tt.want, r.Warnings)
+			}
+		})
+	}
+}
+
+// TestParseRobotsTxtCrawlDelay tests that crawl-delays which aren't a finite number of seconds are ignored, and long ones are limited
+func TestParseRobotsTxtCrawlDelay(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		warn  bool
+	}{
+		{value: "2.5", want: 2500 * time.Millisecond},
+		{value: "-0", want: 0},
+		{value: "-1", warn: true},
+		{value: "NaN", warn: true},
+		{value: "Inf", warn: true},
+		{value: "-Inf", warn: true},
+		{value: "1e300", want: robotsMaxCrawlDelay, warn: true},
+		{value: "86401", want: robotsMaxCrawlDelay, warn: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			r := ParseRobotsTxt(strings.NewReader("User-agent: MyBot\nCrawl-delay: " + tt.value + "\n"))
+			if len(r.Groups) != 1 || r.Groups[0].CrawlDelay != tt.want {
+				t.Errorf("expected a crawl-delay of %s, got %+v", tt.want, r.Groups)
+			}
+			if (len(r.Warnings) > 0) != tt.warn {
+				t.Errorf("expected warnings to be %t, got %v", tt.warn, r.Warnings)
+			}
+		})
+	}
+}
+
+// TestRobotsTxtStringExtensions tests that crawl-delays and unknown directives survive rendering the file again
+func TestRobotsTxtStringExtensions(t *testing.T) {
+	content := "Host: example.com\n\nUser-agent: MyBot\nCrawl-delay: 10\nDisallow: /\nClean-param: ref\n"
+	r := ParseRobotsTxt(strings.NewReader(content))
+	if out := r.String(); out != content {
+		t.Errorf("rendered robots.txt did not match. Expected:\n%s\nGot:\n%s", content, out)
+	}
+}
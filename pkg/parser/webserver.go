@@ -0,0 +1,271 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	regexNginxMap = `(?im)^\s*map\s+\$http_user_agent\s`
+	// an entry of a map block with a regex key, for lists that ship only the body of the map
+	regexNginxEntry      = `(?m)^\s*["']?~\*?\S+\s+\S+\s*;`
+	regexApacheUserAgent = `(?im)^\s*(?:RewriteCond\s+%\{HTTP_USER_AGENT\}|BrowserMatch(?:NoCase)?|SetEnvIf(?:NoCase)?\s+User-Agent)\s`
+
+	// webServerMaxLine allows for the long alternations some lists put on a single line.
+	webServerMaxLine = 1024 * 1024
+)
+
+// configLine is the arguments of a line from a web server config file.
+type configLine struct {
+	num  int
+	args []string
+}
+
+// readConfigLines splits a web server config file into the arguments of each line, skipping comments and blank lines.
+func readConfigLines(r *bufio.Reader) ([]configLine, error) {
+	var lines []configLine
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, webServerMaxLine)
+	n := 0
+	for s.Scan() {
+		n++
+		a := splitConfigArgs(s.Text())
+		if len(a) > 0 {
+			lines = append(lines, configLine{num: n, args: a})
+		}
+	}
+	return lines, s.Err()
+}
+
+// splitConfigArgs splits a line into whitespace separated arguments, honoring quotes, and stops at a comment.
+// Within quotes, a backslash escapes the quote character or another backslash. Any other backslash is kept, as it's likely part of a regex.
+func splitConfigArgs(l string) []string {
+	var args []string
+	var cur strings.Builder
+	var quote byte
+	inArg := false
+	for i := 0; i < len(l); i++ {
+		c := l[i]
+		switch {
+		case quote != 0 && c == '\\' && i+1 < len(l) && (l[i+1] == quote || l[i+1] == '\\'):
+			i++
+			cur.WriteByte(l[i])
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteByte(c)
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\r':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case c == '#' && !inArg:
+			return args
+		default:
+			cur.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args
+}
+
+// addUserAgentExpr adds a user-agent expression from a web server config to the index.
+// A case-sensitive regex without any special characters is added as a plain bot name, so it can be found by the faster substring search.
+func (r *RobotsIndex) addUserAgentExpr(expr string, exact bool, fold bool, line int) error {
+	if exact {
+		expr = "^" + regexp.QuoteMeta(expr) + "$"
+	} else if !fold && regexp.QuoteMeta(expr) == expr {
+		(*r)[expr] = BotUserAgent{}
+		return nil
+	}
+	if fold {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid pattern '%s' on line %d. %w", expr, line, err)
+	}
+	(*r)[expr] = BotUserAgent{Pattern: re}
+	return nil
+}
+
+// nginxEntry is a `key value;` entry of an nginx map block.
+type nginxEntry struct {
+	num   int
+	key   string
+	value string
+}
+
+// nginxMapParse parses the entries of an nginx `map $http_user_agent` block, such as those of nginx-ultimate-bad-bot-blocker.
+// Keys prefixed by `~` are regexes, and `~*` case-insensitive ones. Any other key must match the whole User-Agent.
+// Entries mapped to 0 or an empty string are taken to be allowed, and skipped. If the list has no map block, every entry is read as if it were in one.
+// Lists that grade bots with numbers only block the highest grade, such as nginx-ultimate-bad-bot-blocker's 3,
+// so when every value is a number, only entries with the highest one are taken to be bots. See nginxBotValue.
+func nginxMapParse(r *bufio.Reader) (RobotsIndex, error) {
+	rIndex := make(RobotsIndex)
+	lines, err := readConfigLines(r)
+	if err != nil {
+		return rIndex, err
+	}
+	hasMap := false
+	for _, l := range lines {
+		hasMap = hasMap || isNginxUserAgentMap(l.args)
+	}
+
+	var entries []nginxEntry
+	inMap := !hasMap
+	for _, l := range lines {
+		switch {
+		case l.args[0] == "map":
+			inMap = isNginxUserAgentMap(l.args)
+		case l.args[0] == "}":
+			inMap = !hasMap
+		case inMap:
+			if e, ok := parseNginxEntry(l); ok {
+				entries = append(entries, e)
+			}
+		}
+	}
+	botValue, graded := nginxBotValue(entries)
+	for _, e := range entries {
+		if n, _ := strconv.Atoi(e.value); graded && n != botValue {
+			continue
+		}
+		err = rIndex.addNginxEntry(e)
+		if err != nil {
+			return rIndex, err
+		}
+	}
+	return rIndex, nil
+}
+
+func isNginxUserAgentMap(args []string) bool {
+	return len(args) > 1 && args[0] == "map" && strings.EqualFold(args[1], "$http_user_agent")
+}
+
+// parseNginxEntry reads a `key value;` entry of a map block, skipping parameters of the block and entries that allow a bot.
+func parseNginxEntry(l configLine) (nginxEntry, bool) {
+	args := l.args
+	if len(args) > 0 && args[len(args)-1] == ";" {
+		args = args[:len(args)-1]
+	}
+	if len(args) != 2 {
+		return nginxEntry{}, false
+	}
+	e := nginxEntry{num: l.num, key: args[0], value: strings.TrimSuffix(args[1], ";")}
+	switch e.key {
+	case "default", "hostnames", "volatile", "include":
+		return e, false
+	}
+	return e, e.value != "0" && e.value != ""
+}
+
+// nginxBotValue finds the highest value of the entries, if every one of them is a number.
+// Otherwise, the list doesn't grade its bots, and every entry is taken to be one.
+func nginxBotValue(entries []nginxEntry) (int, bool) {
+	highest := 0
+	for i, e := range entries {
+		n, err := strconv.Atoi(e.value)
+		if err != nil {
+			return 0, false
+		}
+		if i == 0 || n > highest {
+			highest = n
+		}
+	}
+	return highest, len(entries) > 0
+}
+
+// addNginxEntry adds an entry of a map block to the index.
+func (r *RobotsIndex) addNginxEntry(e nginxEntry) error {
+	k := e.key
+	switch {
+	case strings.HasPrefix(k, "~*"):
+		return r.addUserAgentExpr(k[2:], false, true, e.num)
+	case strings.HasPrefix(k, "~"):
+		return r.addUserAgentExpr(k[1:], false, false, e.num)
+	default:
+		// a leading backslash escapes a key that would otherwise be taken as a regex or parameter
+		return r.addUserAgentExpr(strings.TrimPrefix(k, "\\"), true, false, e.num)
+	}
+}
+
+// apacheParse parses the user-agent conditions of Apache config, such as those of apache-ultimate-bad-bot-blocker.
+// These are `RewriteCond %{HTTP_USER_AGENT}` lines, which are case-insensitive with the [NC] flag,
+// and `BrowserMatch` or `SetEnvIf User-Agent` lines, which are case-insensitive in their NoCase variants.
+// Negated conditions are taken to allow a bot, and skipped. As lists also use these lines to mark good bots or other traffic,
+// a BrowserMatch or SetEnvIf line is only taken to be a bot when it sets a variable such as `bad_bot`, see isBadBotVar.
+func apacheParse(r *bufio.Reader) (RobotsIndex, error) {
+	rIndex := make(RobotsIndex)
+	lines, err := readConfigLines(r)
+	if err != nil {
+		return rIndex, err
+	}
+	for _, l := range lines {
+		a := l.args
+		d := strings.ToLower(a[0])
+		switch {
+		case d == "rewritecond" && len(a) > 2 && strings.EqualFold(a[1], "%{HTTP_USER_AGENT}"):
+			err = rIndex.addRewriteCond(l)
+		case (d == "browsermatch" || d == "browsermatchnocase") && len(a) > 2 && slices.ContainsFunc(a[2:], isBadBotVar):
+			err = rIndex.addUserAgentExpr(a[1], false, d == "browsermatchnocase", l.num)
+		case (d == "setenvif" || d == "setenvifnocase") && len(a) > 3 && strings.EqualFold(a[1], "User-Agent") && slices.ContainsFunc(a[3:], isBadBotVar):
+			err = rIndex.addUserAgentExpr(a[2], false, d == "setenvifnocase", l.num)
+		}
+		if err != nil {
+			return rIndex, err
+		}
+	}
+	return rIndex, nil
+}
+
+// isBadBotVar reports whether a `var[=value]` argument of a BrowserMatch or SetEnvIf line marks a bad bot.
+// The variable's name must say so, such as `bad_bot` or `BlockBot`, which also rules out ones like `good_bot`.
+// Unset variables, prefixed with '!', and those set to 0 or an empty value, are taken to allow a bot.
+func isBadBotVar(v string) bool {
+	name, val, hasVal := strings.Cut(v, "=")
+	if strings.HasPrefix(name, "!") || (hasVal && (val == "" || val == "0")) {
+		return false
+	}
+	name = strings.ToLower(name)
+	for _, k := range []string{"bad", "block", "deny", "spam"} {
+		if strings.Contains(name, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// addRewriteCond adds a `RewriteCond %{HTTP_USER_AGENT} pattern [flags]` line to the index.
+// Only regexes and `=` string comparisons are supported, other comparisons are skipped.
+func (r *RobotsIndex) addRewriteCond(l configLine) error {
+	p := l.args[2]
+	fold := false
+	if len(l.args) > 3 {
+		for _, f := range strings.Split(strings.Trim(l.args[3], "[]"), ",") {
+			f = strings.TrimSpace(f)
+			fold = fold || strings.EqualFold(f, "NC") || strings.EqualFold(f, "nocase")
+		}
+	}
+	switch {
+	case strings.HasPrefix(p, "!"):
+		return nil
+	case strings.HasPrefix(p, "="):
+		return r.addUserAgentExpr(p[1:], true, fold, l.num)
+	case strings.HasPrefix(p, "-") || strings.HasPrefix(p, "<") || strings.HasPrefix(p, ">"):
+		return nil
+	default:
+		return r.addUserAgentExpr(p, false, fold, l.num)
+	}
+}
@@ -0,0 +1,204 @@
+package parser
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testNginxMap = `# bad bots
+map $http_referer $bad_referer {
+    default 0;
+    "~*spam" 1;
+}
+map $http_user_agent $bad_bot {
+    default 0;
+    hostnames;
+    "~*(?:\b)AhrefsBot(?:\b)"  3;
+    ~MJ12bot 3; # a trailing comment
+    "~*Googlebot"  0;
+    "~*bingbot" 1;
+    "~*Applebot" 2;
+    "Exact Agent/1.0" 3;
+}
+`
+
+const testApache = `# bad bots
+RewriteEngine On
+RewriteCond %{HTTP_USER_AGENT} ^.*(AhrefsBot|SemrushBot).*$ [NC,OR]
+RewriteCond %{HTTP_USER_AGENT} "MJ12bot" [OR]
+RewriteCond %{HTTP_USER_AGENT} "=Exact Agent/1.0"
+RewriteCond %{HTTP_USER_AGENT} !Googlebot [NC]
+RewriteCond %{HTTP_REFERER} spam [NC]
+BrowserMatchNoCase "^DotBot" bad_bot
+BrowserMatch "^bingbot" !bad_bot
+BrowserMatchNoCase "Googlebot" good_bot
+BrowserMatchNoCase "Bytespider" blockbot=1
+BrowserMatchNoCase "Applebot" bad_bot=0
+SetEnvIfNoCase User-Agent "PetalBot" bad_bot
+SetEnvIfNoCase User-Agent "Mobile" is_mobile
+RewriteRule .* - [F,L]
+`
+
+// TestWebServerParse tests that nginx and Apache lists are parsed into tokens and regexes, keeping their case-sensitivity
+func TestWebServerParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		want    map[string]string
+		notWant []string
+		size    int
+	}{
+		{
+			name:    "Nginx",
+			content: testNginxMap,
+			want: map[string]string{
+				`(?i)(?:\b)AhrefsBot(?:\b)`: "Mozilla/5.0 (compatible; ahrefsbot/7.0)",
+				"MJ12bot":                   "MJ12bot/v1.4.8",
+				`^Exact Agent/1\.0$`:        "Exact Agent/1.0",
+			},
+			notWant: []string{"Mozilla/5.0 (compatible; MJ12Bot/v1.4.8)", "Exact Agent/1.0 (extra)", "Googlebot/2.1", "bingbot/2.0", "Applebot/0.1", "spam"},
+			size:    3,
+		},
+		{
+			name:    "NginxMapBody",
+			format:  FormatNginx,
+			content: "\"~*AhrefsBot\" 1;\n\"~MJ12bot\" 1;\n",
+			want:    map[string]string{"(?i)AhrefsBot": "AHREFSBOT", "MJ12bot": "MJ12bot"},
+			size:    2,
+		},
+		{
+			name:    "NginxUngraded",
+			format:  FormatNginx,
+			content: "\"~*AhrefsBot\" bad;\n\"~MJ12bot\" 2;\n\"~*Googlebot\" 0;\n",
+			want:    map[string]string{"(?i)AhrefsBot": "AHREFSBOT", "MJ12bot": "MJ12bot"},
+			notWant: []string{"Googlebot/2.1"},
+			size:    2,
+		},
+		{
+			name:    "Apache",
+			content: testApache,
+			want: map[string]string{
+				`(?i)^.*(AhrefsBot|SemrushBot).*$`: "Mozilla/5.0 (compatible; semrushbot/7)",
+				"MJ12bot":                          "MJ12bot/v1.4.8",
+				`^Exact Agent/1\.0$`:               "Exact Agent/1.0",
+				`(?i)^DotBot`:                      "dotbot/1.2",
+				`(?i)PetalBot`:                     "petalbot",
+				`(?i)Bytespider`:                   "bytespider",
+			},
+			notWant: []string{"Googlebot/2.1", "bingbot/2.0", "Applebot/0.1", "Mobile Safari", "spam"},
+			size:    6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(tt.content))
+			}))
+			defer serv.Close()
+
+			s := &Source{URL: serv.URL, Format: tt.format}
+			i, err := s.GetIndex()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(i) != tt.size {
+				t.Errorf("expected %d bots, got %v", tt.size, i)
+			}
+			for name, ua := range tt.want {
+				b, ok := i[name]
+				if !ok {
+					t.Errorf("expected bot '%s' in index, got %v", name, i)
+					continue
+				}
+				if b.Pattern == nil && !strings.Contains(ua, name) || b.Pattern != nil && !b.Pattern.MatchString(ua) {
+					t.Errorf("expected bot '%s' to match '%s'", name, ua)
+				}
+			}
+			for _, ua := range tt.notWant {
+				for name, b := range i {
+					if b.Pattern == nil && strings.Contains(ua, name) || b.Pattern != nil && b.Pattern.MatchString(ua) {
+						t.Errorf("expected '%s' not to match, but bot '%s' did", ua, name)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestWebServerParseInvalid tests that a pattern which doesn't compile is reported with its line
+func TestWebServerParseInvalid(t *testing.T) {
+	for _, format := range []string{FormatNginx, FormatApache} {
+		content := "map $http_user_agent $bad_bot {\n  \"~*(?<=bot)\" 1;\n}\n"
+		if format == FormatApache {
+			content = "RewriteEngine On\nRewriteCond %{HTTP_USER_AGENT} (?<=bot) [NC]\n"
+		}
+		serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte(content))
+		}))
+		s := &Source{URL: serv.URL, Format: format}
+		_, err := s.GetIndex()
+		serv.Close()
+		if err == nil || !strings.Contains(err.Error(), "on line 2") {
+			t.Errorf("%s: expected an invalid pattern error on line 2, got %v", format, err)
+		}
+	}
+}
+
+// TestGetSourceContentTypeSniffLarge tests that content is not truncated when its type is detected early in a large source
+func TestGetSourceContentTypeSniffLarge(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&b, "User-agent: Bot%d\nDisallow: /\n", i)
+	}
+	serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(b.String()))
+	}))
+	defer serv.Close()
+
+	s := &Source{URL: serv.URL}
+	i, err := s.GetIndex()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(i) != 1000 {
+		t.Errorf("expected 1000 bots, got %d", len(i))
+	}
+}
+
+// TestGetSourceContentTypeSniffPrecedence tests that web server config is detected even if a robots.txt line comes first, such as in a location serving one
+func TestGetSourceContentTypeSniffPrecedence(t *testing.T) {
+	robotsLocation := "location = /robots.txt {\n    return 200 \"\nUser-agent: *\nDisallow: /\";\n}\n"
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "Nginx", content: robotsLocation + "map $http_user_agent $bad_bot {\n    \"~*AhrefsBot\" 3;\n}\n", want: contentNginx},
+		{name: "Apache", content: "# User-agent: *\nUser-agent: *\nBrowserMatchNoCase \"AhrefsBot\" bad_bot\n", want: contentApache},
+		{name: "RobotsTxt", content: "User-agent: AhrefsBot\nDisallow: /\n", want: contentRobotsTxt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte(tt.content))
+			}))
+			defer serv.Close()
+
+			// sniff the same content repeatedly, as the format must not depend on the order hints are checked in
+			for n := 0; n < 10; n++ { //nolint:intrange,modernize
+				s := &Source{URL: serv.URL}
+				i, err := s.GetIndex()
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if s.contentType != tt.want || len(i) != 1 {
+					t.Fatalf("expected content type '%s' with one bot, got '%s' with %v", tt.want, s.contentType, i)
+				}
+			}
+		})
+	}
+}
@@ -2,32 +2,356 @@
 package proxy
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/logger"
+)
+
+const (
+	headerBotName     = "X-Bot-Name"
+	headerBotOperator = "X-Bot-Operator"
+
+	transportKeepAlive       = 30 * time.Second
+	transportIdleConnTimeout = 90 * time.Second
+	transportMaxIdleConns    = 100
 )
 
-// BotProxy is a wrapper around httputil.ReverseProxy() to proxy bot requests to a backend server.
+// botContextKey is used to carry the identity of a bot through the request context to the backend.
+type botContextKey struct{}
+
+// botIdentity describes the bot a request is being proxied for.
+type botIdentity struct {
+	name     string
+	operator string
+}
+
+// backend is a single destination server that bot requests can be balanced to.
+type backend struct {
+	url   *url.URL
+	proxy *httputil.ReverseProxy
+
+	weight int
+	// current is the running weight used for smooth weighted round-robin selection
+	current int
+	// healthy is the result of the latest active health check
+	healthy bool
+	// fails counts consecutive passive failures (errors proxying a request)
+	fails        int
+	ejectedUntil time.Time
+}
+
+// available reports whether the backend can currently receive requests.
+func (b *backend) available(now time.Time) bool {
+	return b.healthy && !now.Before(b.ejectedUntil)
+}
+
+// BotProxy is a load balancing wrapper around httputil.ReverseProxy() to proxy bot requests to one or more backend servers.
 type BotProxy struct {
-	Proxy *httputil.ReverseProxy
+	backends []*backend
+	balancer string
+	fallback http.Handler
+	lock     sync.Mutex
+	log      *logger.Log
+	// cursor is the position of the next backend to try for round-robin selection
+	cursor int
+
+	maxFails    int
+	failTimeout time.Duration
+
+	stripHeaders []string
+	host         string
+	preserveHost bool
+	botHeaders   bool
+	timeout      time.Duration
+	transport    *http.Transport
+
+	healthCheckPath     string
+	healthCheckInterval time.Duration
+	healthCheckClient   *http.Client
+}
+
+// New returns a new BotProxy instance that acts as a reverse proxy to the backends configured in botProxyUrl.
+// If no backend is able to take a request, the request is handed to the provided fallback handler instead.
+// Active health checks run in the background until the provided context is done.
+func New(ctx context.Context, c *config.Config, l *logger.Log, fallback http.Handler) *BotProxy {
+	// we validated the time durations and weights earlier, so ignore any error now
+	hcInterval, _ := time.ParseDuration(c.BotProxyHealthCheckInterval)
+	hcTimeout, _ := time.ParseDuration(c.BotProxyHealthCheckTimeout)
+	failTimeout, _ := time.ParseDuration(c.BotProxyFailTimeout)
+	timeout, _ := time.ParseDuration(c.BotProxyTimeout)
+	t := newTransport(c)
+	bP := &BotProxy{
+		balancer:            c.BotProxyBalancer,
+		fallback:            fallback,
+		log:                 l,
+		maxFails:            c.BotProxyMaxFails,
+		failTimeout:         failTimeout,
+		host:                c.BotProxyHost,
+		preserveHost:        c.BotProxyPreserveHost,
+		botHeaders:          c.BotProxyBotHeaders,
+		timeout:             timeout,
+		transport:           t,
+		healthCheckPath:     c.BotProxyHealthCheckPath,
+		healthCheckInterval: hcInterval,
+		healthCheckClient:   &http.Client{Timeout: hcTimeout, Transport: t},
+	}
+	for _, h := range strings.Split(c.BotProxyStripHeaders, ",") {
+		h = strings.TrimSpace(h)
+		if h != "" {
+			bP.stripHeaders = append(bP.stripHeaders, h)
+		}
+	}
+
+	var weights []string
+	if c.BotProxyWeights != "" {
+		weights = strings.Split(c.BotProxyWeights, ",")
+	}
+	for i, u := range strings.Split(c.BotProxyURL, ",") {
+		w := 1
+		if i < len(weights) {
+			w, _ = strconv.Atoi(strings.TrimSpace(weights[i]))
+		}
+		bP.backends = append(bP.backends, bP.newBackend(strings.TrimSpace(u), w))
+	}
+
+	// we could check connectivity to the backends before setting up here, but in case the destination wants real requests
+	// or is just temporarily unavailable, we won't fail the initialization. Backends start out healthy.
+	if bP.healthCheckPath != "" && bP.healthCheckInterval > 0 {
+		go bP.runHealthChecks(ctx)
+	}
+
+	return bP
+}
+
+// newTransport builds the transport used to reach backends, applying the configured timeouts and TLS settings.
+func newTransport(c *config.Config) *http.Transport {
+	dialTimeout, _ := time.ParseDuration(c.BotProxyDialTimeout)
+	headerTimeout, _ := time.ParseDuration(c.BotProxyResponseHeaderTimeout)
+	d := &net.Dialer{Timeout: dialTimeout, KeepAlive: transportKeepAlive}
+	return &http.Transport{
+		DialContext:           d.DialContext,
+		ForceAttemptHTTP2:     true,
+		IdleConnTimeout:       transportIdleConnTimeout,
+		MaxIdleConns:          transportMaxIdleConns,
+		ResponseHeaderTimeout: headerTimeout,
+		// tarpits are commonly internal services with self-signed certificates
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: c.BotProxyInsecureSkipVerify}, //nolint:gosec
+	}
 }
 
-// New returns a new BotProxy instance that acts as a reverse proxy to the provided url.
-func New(u string) *BotProxy {
+// newBackend initializes a reverse proxy to the provided url, reporting its outcomes back to the BotProxy.
+func (bP *BotProxy) newBackend(u string, weight int) *backend {
 	// we don't error check since it was already done in ValidateConfig()
 	dURL, _ := url.Parse(u)
-	// we could check connectivity to the URL before setting up here, but in case the destination wants real requests
-	// or is just temporarily unavailable, we won't fail the initialization
+	b := &backend{url: dURL, weight: weight, healthy: true}
 	rP := httputil.NewSingleHostReverseProxy(dURL)
 	// since we're likely sending this request to a "tarpit" style application, we shouldn't buffer the response for performance
 	rP.BufferPool = nil
-	bP := BotProxy{rP}
+	rP.Transport = bP.transport
+	director := rP.Director
+	rP.Director = func(r *http.Request) {
+		director(r)
+		bP.shapeRequest(r, b)
+	}
+	rP.ModifyResponse = func(resp *http.Response) error {
+		// an overloaded or crashing backend may still answer, so server errors count against it like failing to connect
+		if resp.StatusCode >= http.StatusInternalServerError {
+			bP.log.Warn("BotProxy: backend '"+b.url.String()+"' responded with "+resp.Status, "requestedPath", resp.Request.URL.Path)
+			bP.markFailed(b)
+			return nil
+		}
+		bP.markSuccess(b)
+		return nil
+	}
+	rP.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// the bot went away, or the request ran into our total timeout. Neither is the backend's fault
+		if r.Context().Err() != nil {
+			bP.log.Debug("BotProxy: request to backend '"+b.url.String()+"' ended early. Error: "+err.Error(), "requestedPath", r.URL.Path)
+			if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+				bP.fallback.ServeHTTP(w, r)
+			}
+			return
+		}
+		bP.log.Warn("BotProxy: error proxying request to backend '"+b.url.String()+"', falling back. Error: "+err.Error(), "requestedPath", r.URL.Path)
+		bP.markFailed(b)
+		bP.fallback.ServeHTTP(w, r)
+	}
+	b.proxy = rP
+	return b
+}
+
+// shapeRequest modifies the outgoing request to a backend: scrubbing headers, setting the Host, and identifying the bot.
+func (bP *BotProxy) shapeRequest(r *http.Request, b *backend) {
+	for _, h := range bP.stripHeaders {
+		r.Header.Del(h)
+	}
+
+	switch {
+	case bP.host != "":
+		r.Host = bP.host
+	case !bP.preserveHost:
+		r.Host = b.url.Host
+	}
 
-	return &bP
+	// never forward these as sent by the client, they could be spoofed
+	r.Header.Del(headerBotName)
+	r.Header.Del(headerBotOperator)
+	if !bP.botHeaders {
+		return
+	}
+	bot, ok := r.Context().Value(botContextKey{}).(botIdentity)
+	if !ok {
+		return
+	}
+	if bot.name != "" {
+		r.Header.Set(headerBotName, bot.name)
+	}
+	if bot.operator != "" {
+		r.Header.Set(headerBotOperator, bot.operator)
+	}
 }
 
-// ServeHTTP Handles forwarding the request to the designated destination.
+// ServeHTTP Handles forwarding the request to the next available backend, or the fallback handler if none are available.
 func (bP *BotProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bP.ServeBot(w, r, "", "")
+}
+
+// ServeBot forwards the request like ServeHTTP, identifying the bot to the backend by name and operator.
+func (bP *BotProxy) ServeBot(w http.ResponseWriter, r *http.Request, name string, operator string) {
+	ctx := context.WithValue(r.Context(), botContextKey{}, botIdentity{name: name, operator: operator})
+	if bP.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, bP.timeout)
+		defer cancel()
+	}
+	r = r.WithContext(ctx)
+
+	b := bP.pick()
+	if b == nil {
+		bP.log.Warn("BotProxy: no healthy backend available, falling back", "requestedPath", r.URL.Path)
+		bP.fallback.ServeHTTP(w, r)
+		return
+	}
 	// we assume NewSingleHostReverseProxy gives us a ReverseProxy that automatically handles forwarded headers (e.g. X-Forwarded-For)
-	bP.Proxy.ServeHTTP(w, r)
+	b.proxy.ServeHTTP(w, r)
+}
+
+// pick selects the next backend to send a request to based on the configured balancer. Returns nil if none are available.
+func (bP *BotProxy) pick() *backend {
+	bP.lock.Lock()
+	defer bP.lock.Unlock()
+	now := time.Now()
+	if bP.balancer == config.BotProxyBalancerWeighted {
+		return bP.pickWeighted(now)
+	}
+	return bP.pickRoundRobin(now)
+}
+
+// pickRoundRobin selects the next available backend in order.
+func (bP *BotProxy) pickRoundRobin(now time.Time) *backend {
+	for range bP.backends {
+		b := bP.backends[bP.cursor%len(bP.backends)]
+		bP.cursor = (bP.cursor + 1) % len(bP.backends)
+		if b.available(now) {
+			return b
+		}
+	}
+	return nil
+}
+
+// pickWeighted selects an available backend using smooth weighted round-robin, so heavier backends aren't picked in bursts.
+func (bP *BotProxy) pickWeighted(now time.Time) *backend {
+	var best *backend
+	total := 0
+	for _, b := range bP.backends {
+		if !b.available(now) {
+			continue
+		}
+		b.current += b.weight
+		total += b.weight
+		if best == nil || b.current > best.current {
+			best = b
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+// markSuccess resets the passive failure count of a backend.
+func (bP *BotProxy) markSuccess(b *backend) {
+	bP.lock.Lock()
+	defer bP.lock.Unlock()
+	b.fails = 0
+}
+
+// markFailed records a passive failure for a backend, ejecting it for failTimeout once maxFails is reached.
+func (bP *BotProxy) markFailed(b *backend) {
+	bP.lock.Lock()
+	defer bP.lock.Unlock()
+	b.fails++
+	if b.fails >= bP.maxFails {
+		b.fails = 0
+		b.ejectedUntil = time.Now().Add(bP.failTimeout)
+		bP.log.Warn("BotProxy: ejecting backend '" + b.url.String() + "' after repeated errors until " + b.ejectedUntil.Format(time.RFC1123))
+	}
+}
+
+// runHealthChecks actively checks each backend every healthCheckInterval, until the context is done.
+func (bP *BotProxy) runHealthChecks(ctx context.Context) {
+	t := time.NewTicker(bP.healthCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			for _, b := range bP.backends {
+				bP.setHealthy(b, bP.checkHealth(ctx, b))
+			}
+		}
+	}
+}
+
+// checkHealth requests the health check path from a backend. Any 2xx or 3xx response is considered healthy.
+func (bP *BotProxy) checkHealth(ctx context.Context, b *backend) bool {
+	u := b.url.JoinPath(bP.healthCheckPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	res, err := bP.healthCheckClient.Do(req)
+	if err != nil {
+		return false
+	}
+	// we only care about the status, a tarpit may never finish sending the body
+	_ = res.Body.Close()
+	return res.StatusCode >= http.StatusOK && res.StatusCode < http.StatusBadRequest
+}
+
+// setHealthy stores the result of a health check, logging any change of state.
+func (bP *BotProxy) setHealthy(b *backend, healthy bool) {
+	bP.lock.Lock()
+	defer bP.lock.Unlock()
+	if b.healthy == healthy {
+		return
+	}
+	b.healthy = healthy
+	if healthy {
+		bP.log.Info("BotProxy: backend '" + b.url.String() + "' passed health check, marking healthy")
+	} else {
+		bP.log.Warn("BotProxy: backend '" + b.url.String() + "' failed health check, marking unhealthy")
+	}
 }
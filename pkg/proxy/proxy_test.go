@@ -1,41 +1,85 @@
 package proxy
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/logger"
 )
 
-// TestBotProxyNew tests the default initialization behavior of proxy.New()
-func TestBotProxyNew(_ *testing.T) {
-	_ = New("http://localhost")
+var testLogOut bytes.Buffer //nolint:gochecknoglobals
+
+const fallbackBody = "fallback handler reached"
+
+// fallbackHandler is used in place of the plugin's BLOCK response
+func fallbackHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = fmt.Fprint(w, fallbackBody)
+	})
 }
 
-// TestBotProxyServe tests that the BotProxy actually forwards a request to the backend server
-func TestBotProxyServe(t *testing.T) {
-	want := "the backend server has been reached by the reverse proxy"
-	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		t.Helper()
-		_, err := fmt.Fprint(w, want)
-		if err != nil {
-			t.Fatal(err)
-		}
-	}))
-	defer backendServer.Close()
+// testContext is a helper function to get a context that is canceled when the test finishes, stopping health checks
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return ctx
+}
 
-	ctx := context.Background()
+// newTestProxy is a helper function to construct a BotProxy to the provided backend URLs with default configuration
+func newTestProxy(t *testing.T, urls ...string) (*BotProxy, *config.Config) {
+	t.Helper()
+	c := config.New()
+	c.BotProxyURL = strings.Join(urls, ",")
+	return New(testContext(t), c, logger.NewFromWriter("DEBUG", &testLogOut), fallbackHandler()), c
+}
 
-	p := New(backendServer.URL)
+// newNamedBackend is a helper function to start a backend server that responds with its own name
+func newNamedBackend(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, name)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
 
+// proxyRequest is a helper function to send a request through the BotProxy and return the response body
+func proxyRequest(t *testing.T, p *BotProxy) (int, string) {
+	t.Helper()
 	recorder := httptest.NewRecorder()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://localhost/", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	p.ServeHTTP(recorder, req)
-	got := recorder.Body.String()
+	return recorder.Code, recorder.Body.String()
+}
+
+// TestBotProxyNew tests the default initialization behavior of proxy.New()
+func TestBotProxyNew(t *testing.T) {
+	p, _ := newTestProxy(t, "http://localhost", "http://127.0.0.1:8080")
+	if len(p.backends) != 2 {
+		t.Errorf("expected 2 backends to be configured, got %d", len(p.backends))
+	}
+}
+
+// TestBotProxyServe tests that the BotProxy actually forwards a request to the backend server
+func TestBotProxyServe(t *testing.T) {
+	want := "the backend server has been reached by the reverse proxy"
+	backendServer := newNamedBackend(t, want)
+
+	p, _ := newTestProxy(t, backendServer.URL)
+	_, got := proxyRequest(t, p)
 	if got != want {
 		t.Error("the BotProxy did not forward the response to the backend server")
 	}
@@ -54,7 +98,7 @@ func TestReverseProxyNoBuffering(t *testing.T) {
 	}))
 	defer backendServer.Close()
 
-	p := New(backendServer.URL)
+	p, _ := newTestProxy(t, backendServer.URL)
 	ctx := context.Background()
 	recorder := httptest.NewRecorder()
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/", nil)
@@ -78,3 +122,210 @@ func TestReverseProxyNoBuffering(t *testing.T) {
 		t.Errorf("Unexpected Content-Length: %s", resCL)
 	}
 }
+
+// TestBotProxyRoundRobin tests that requests are spread evenly across backends
+func TestBotProxyRoundRobin(t *testing.T) {
+	a := newNamedBackend(t, "a")
+	b := newNamedBackend(t, "b")
+	p, _ := newTestProxy(t, a.URL, b.URL)
+
+	counts := map[string]int{}
+	// yaegi doesn't like a range over int loop
+	// https://github.com/traefik/yaegi/issues/1701
+	for i := 0; i < 10; i++ { //nolint:intrange,modernize
+		_, got := proxyRequest(t, p)
+		counts[got]++
+	}
+	if counts["a"] != 5 || counts["b"] != 5 {
+		t.Errorf("expected round-robin to split requests evenly, got %v", counts)
+	}
+}
+
+// TestBotProxyWeighted tests that requests are spread across backends according to their weights
+func TestBotProxyWeighted(t *testing.T) {
+	a := newNamedBackend(t, "a")
+	b := newNamedBackend(t, "b")
+	c := config.New()
+	c.BotProxyURL = a.URL + "," + b.URL
+	c.BotProxyBalancer = config.BotProxyBalancerWeighted
+	c.BotProxyWeights = "3,1"
+	p := New(testContext(t), c, logger.NewFromWriter("DEBUG", &testLogOut), fallbackHandler())
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ { //nolint:intrange,modernize
+		_, got := proxyRequest(t, p)
+		counts[got]++
+	}
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Errorf("expected weighted balancing to split requests 3:1, got %v", counts)
+	}
+}
+
+// TestBotProxyPassiveEjection tests that a backend erroring repeatedly is ejected, and requests fall back instead of returning a 502
+func TestBotProxyPassiveEjection(t *testing.T) {
+	dead := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	dead.Close()
+	alive := newNamedBackend(t, "alive")
+	p, c := newTestProxy(t, dead.URL, alive.URL)
+
+	fallbacks := 0
+	for i := 0; i < c.BotProxyMaxFails*2; i++ { //nolint:intrange,modernize
+		status, got := proxyRequest(t, p)
+		if status == http.StatusBadGateway {
+			t.Fatal("BotProxy returned a 502 instead of falling back")
+		}
+		if got == fallbackBody {
+			fallbacks++
+		}
+	}
+	if fallbacks != c.BotProxyMaxFails {
+		t.Errorf("expected %d fallback responses before the dead backend was ejected, got %d", c.BotProxyMaxFails, fallbacks)
+	}
+	if p.backends[0].available(time.Now()) {
+		t.Error("expected the dead backend to be ejected after repeated errors")
+	}
+	_, got := proxyRequest(t, p)
+	if got != "alive" {
+		t.Errorf("expected requests to go to the remaining backend after ejection, got '%s'", got)
+	}
+}
+
+// TestBotProxyPassiveEjectionServerError tests that a backend answering every request with a server error is ejected like one that can't be reached
+func TestBotProxyPassiveEjectionServerError(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failing.Close)
+	alive := newNamedBackend(t, "alive")
+	p, c := newTestProxy(t, failing.URL, alive.URL)
+
+	for i := 0; i < c.BotProxyMaxFails*2; i++ { //nolint:intrange,modernize
+		_, _ = proxyRequest(t, p)
+	}
+	if p.backends[0].available(time.Now()) {
+		t.Error("expected the backend responding with server errors to be ejected")
+	}
+	if !p.backends[1].available(time.Now()) {
+		t.Error("expected the healthy backend to remain available")
+	}
+}
+
+// TestBotProxyHealthCheck tests that a backend failing its active health check stops receiving requests, falling back when none are left
+func TestBotProxyHealthCheck(t *testing.T) {
+	var lock sync.Mutex
+	healthy := true
+	backendServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.URL.Path == "/healthz" && !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprint(w, "backend")
+	}))
+	defer backendServer.Close()
+
+	c := config.New()
+	c.BotProxyURL = backendServer.URL
+	c.BotProxyHealthCheckPath = "/healthz"
+	p := New(testContext(t), c, logger.NewFromWriter("DEBUG", &testLogOut), fallbackHandler())
+
+	b := p.backends[0]
+	p.setHealthy(b, p.checkHealth(testContext(t), b))
+	_, got := proxyRequest(t, p)
+	if got != "backend" {
+		t.Errorf("expected request to reach the healthy backend, got '%s'", got)
+	}
+
+	lock.Lock()
+	healthy = false
+	lock.Unlock()
+	p.setHealthy(b, p.checkHealth(testContext(t), b))
+	status, got := proxyRequest(t, p)
+	if got != fallbackBody || status != http.StatusForbidden {
+		t.Errorf("expected request to fall back when no backend is healthy, got %d '%s'", status, got)
+	}
+}
+
+// TestBotProxyShapeRequest tests that configured headers are stripped, the bot is identified, and the Host header is handled per config
+func TestBotProxyShapeRequest(t *testing.T) {
+	type scenario struct {
+		host         string
+		preserveHost bool
+		botHeaders   bool
+		wantHost     string
+	}
+	var lock sync.Mutex
+	var got *http.Request
+	backendServer := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		got = r
+	}))
+	defer backendServer.Close()
+	backendHost := strings.TrimPrefix(backendServer.URL, "http://")
+
+	scenarios := map[string]scenario{
+		"preserveHost": {preserveHost: true, botHeaders: true, wantHost: "example.com"},
+		"backendHost":  {preserveHost: false, botHeaders: true, wantHost: backendHost},
+		"overrideHost": {host: "tarpit.internal", preserveHost: true, botHeaders: false, wantHost: "tarpit.internal"},
+	}
+	for name, s := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			c := config.New()
+			c.BotProxyURL = backendServer.URL
+			c.BotProxyHost = s.host
+			c.BotProxyPreserveHost = s.preserveHost
+			c.BotProxyBotHeaders = s.botHeaders
+			p := New(testContext(t), c, logger.NewFromWriter("DEBUG", &testLogOut), fallbackHandler())
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://example.com/", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Cookie", "session=secret")
+			req.Header.Set("Authorization", "Bearer secret")
+			req.Header.Set("X-Bot-Name", "spoofed")
+			p.ServeBot(httptest.NewRecorder(), req, "GPTBot", "OpenAI")
+
+			lock.Lock()
+			defer lock.Unlock()
+			if got.Header.Get("Cookie") != "" || got.Header.Get("Authorization") != "" {
+				t.Error("expected Cookie and Authorization headers to be stripped from the proxied request")
+			}
+			if got.Host != s.wantHost {
+				t.Errorf("expected proxied request Host '%s', got '%s'", s.wantHost, got.Host)
+			}
+			wantName, wantOperator := "", ""
+			if s.botHeaders {
+				wantName, wantOperator = "GPTBot", "OpenAI"
+			}
+			if got.Header.Get("X-Bot-Name") != wantName || got.Header.Get("X-Bot-Operator") != wantOperator {
+				t.Errorf("expected bot headers '%s'/'%s', got '%s'/'%s'", wantName, wantOperator, got.Header.Get("X-Bot-Name"), got.Header.Get("X-Bot-Operator"))
+			}
+		})
+	}
+}
+
+// TestBotProxyResponseHeaderTimeout tests that a backend that never responds is timed out, and the request falls back
+func TestBotProxyResponseHeaderTimeout(t *testing.T) {
+	done := make(chan struct{})
+	backendServer := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer backendServer.Close()
+	defer close(done)
+
+	c := config.New()
+	c.BotProxyURL = backendServer.URL
+	c.BotProxyResponseHeaderTimeout = "10ms"
+	p := New(testContext(t), c, logger.NewFromWriter("DEBUG", &testLogOut), fallbackHandler())
+
+	_, got := proxyRequest(t, p)
+	if got != fallbackBody {
+		t.Errorf("expected request to a hung backend to fall back, got '%s'", got)
+	}
+}
@@ -0,0 +1,109 @@
+// Package scope provides the Scope type, which decides which requests bot actions are applied to, and which action applies.
+package scope
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+)
+
+// rule overrides the bot action for requests matching its paths and methods.
+type rule struct {
+	paths     []*regexp.Regexp
+	methods   []string
+	botAction string
+}
+
+// Scope holds the path and method filters applied to requests before they are checked against the bot index.
+type Scope struct {
+	exclude []*regexp.Regexp
+	include []*regexp.Regexp
+	methods []string
+	rules   []rule
+}
+
+// New initializes a Scope from the provided (validated) plugin configuration.
+func New(c *config.Config) *Scope {
+	s := &Scope{
+		exclude: compileGlobs(c.ExcludePaths),
+		include: compileGlobs(c.IncludePaths),
+		methods: splitMethods(c.Methods),
+	}
+	for _, cS := range c.Scopes {
+		s.rules = append(s.rules, rule{
+			paths:     compileGlobs(cS.Paths),
+			methods:   splitMethods(cS.Methods),
+			botAction: strings.ToUpper(cS.BotAction),
+		})
+	}
+	return s
+}
+
+// Action returns the bot action to apply to a request with the provided path and method.
+// The first matching scope's action is used, otherwise the provided default. Returns false if the request is out of scope entirely.
+func (s *Scope) Action(path string, method string, defaultAction string) (string, bool) {
+	if matchAny(s.exclude, path) {
+		return "", false
+	}
+	if len(s.include) > 0 && !matchAny(s.include, path) {
+		return "", false
+	}
+	if len(s.methods) > 0 && !slices.Contains(s.methods, method) {
+		return "", false
+	}
+	for _, r := range s.rules {
+		pathMatch := len(r.paths) == 0 || matchAny(r.paths, path)
+		methodMatch := len(r.methods) == 0 || slices.Contains(r.methods, method)
+		if pathMatch && methodMatch {
+			return r.botAction, true
+		}
+	}
+	return defaultAction, true
+}
+
+// compileGlobs converts a comma separated list of path globs into anchored regular expressions.
+// '*' matches within a single path segment, while '**' matches across segments.
+// A glob ending in '/' matches everything under that directory, like one ending in '/**', and both match the directory itself.
+func compileGlobs(globs string) []*regexp.Regexp {
+	var res []*regexp.Regexp
+	if globs == "" {
+		return res
+	}
+	for _, g := range strings.Split(globs, ",") {
+		g = strings.TrimSpace(g)
+		if strings.HasSuffix(g, "/") {
+			g += "**"
+		}
+		dir := strings.HasSuffix(g, "/**")
+		q := regexp.QuoteMeta(strings.TrimSuffix(g, "/**"))
+		q = strings.ReplaceAll(q, `\*\*`, `.*`)
+		q = strings.ReplaceAll(q, `\*`, `[^/]*`)
+		if dir {
+			q += `(?:/.*)?`
+		}
+		res = append(res, regexp.MustCompile("^"+q+"$"))
+	}
+	return res
+}
+
+func splitMethods(methods string) []string {
+	var res []string
+	if methods == "" {
+		return res
+	}
+	for _, m := range strings.Split(methods, ",") {
+		res = append(res, strings.ToUpper(strings.TrimSpace(m)))
+	}
+	return res
+}
+
+func matchAny(globs []*regexp.Regexp, path string) bool {
+	for _, g := range globs {
+		if g.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package scope
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+)
+
+// TestScopeAction tests that requests are excluded, included, and given overriding actions per the configured paths and methods
+func TestScopeAction(t *testing.T) {
+	type scenario struct {
+		path       string
+		method     string
+		wantAction string
+		wantScope  bool
+	}
+	c := config.New()
+	c.ExcludePaths = "/healthz,/.well-known/**,/feeds/*.xml"
+	c.Methods = "GET,head,POST"
+	c.Scopes = []config.Scope{
+		{Paths: "/api/**", Methods: "POST", BotAction: "maze"},
+		{Paths: "/admin/**", BotAction: config.BotActionBlock},
+	}
+	s := New(c)
+
+	scenarios := map[string]scenario{
+		"default":          {path: "/blog/post", method: http.MethodGet, wantAction: config.BotActionLog, wantScope: true},
+		"excluded":         {path: "/healthz", method: http.MethodGet},
+		"excludedDeep":     {path: "/.well-known/acme-challenge/token", method: http.MethodGet},
+		"excludedSegment":  {path: "/feeds/rss.xml", method: http.MethodGet},
+		"singleSegment":    {path: "/feeds/2025/rss.xml", method: http.MethodGet, wantAction: config.BotActionLog, wantScope: true},
+		"unlistedMethod":   {path: "/blog/post", method: http.MethodDelete},
+		"scopeOverride":    {path: "/admin/users", method: http.MethodGet, wantAction: config.BotActionBlock, wantScope: true},
+		"scopeMethod":      {path: "/api/v1/items", method: http.MethodPost, wantAction: config.BotActionMaze, wantScope: true},
+		"scopeOtherMethod": {path: "/api/v1/items", method: http.MethodGet, wantAction: config.BotActionLog, wantScope: true},
+	}
+	for name, sc := range scenarios {
+		t.Run(name, func(t *testing.T) {
+			a, inScope := s.Action(sc.path, sc.method, config.BotActionLog)
+			if a != sc.wantAction || inScope != sc.wantScope {
+				t.Errorf("expected action '%s' in scope %t, got '%s' %t", sc.wantAction, sc.wantScope, a, inScope)
+			}
+		})
+	}
+}
+
+// TestScopeInclude tests that only included paths are in scope when IncludePaths is set
+func TestScopeInclude(t *testing.T) {
+	c := config.New()
+	c.IncludePaths = "/docs/**"
+	s := New(c)
+	if _, inScope := s.Action("/docs/guide", http.MethodGet, config.BotActionLog); !inScope {
+		t.Error("expected an included path to be in scope")
+	}
+	if _, inScope := s.Action("/shop", http.MethodGet, config.BotActionLog); inScope {
+		t.Error("expected a path not included to be out of scope")
+	}
+}
+
+// TestScopeDirectoryGlobs tests that a glob ending in '/' matches everything under the directory, and directory globs match the directory itself
+func TestScopeDirectoryGlobs(t *testing.T) {
+	c := config.New()
+	c.ExcludePaths = "/.well-known/,/static/**"
+	s := New(c)
+	for path, wantScope := range map[string]bool{
+		"/.well-known":                      false,
+		"/.well-known/":                     false,
+		"/.well-known/acme-challenge/token": false,
+		"/static":                           false,
+		"/static/css/site.css":              false,
+		"/.well-knownish":                   true,
+		"/staticfiles":                      true,
+	} {
+		if _, inScope := s.Action(path, http.MethodGet, config.BotActionLog); inScope != wantScope {
+			t.Errorf("expected '%s' in scope %t, got %t", path, wantScope, inScope)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Package throttle enforces the delay between requests that bots are asked to keep to.
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracker records when each bot and client IP pair may next make a request.
+type Tracker struct {
+	next map[[2]string]time.Time
+	lock sync.Mutex
+}
+
+// New initializes an empty Tracker.
+func New() *Tracker {
+	return &Tracker{
+		next: make(map[[2]string]time.Time),
+	}
+}
+
+// Allow reports whether a request from the bot and client IP comes at least delay after their last allowed request.
+// Requests that aren't allowed don't restart the delay, so a bot that backs off as asked isn't penalized for its earlier requests.
+func (t *Tracker) Allow(bot string, ip string, delay time.Duration, now time.Time) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	k := [2]string{bot, ip}
+	if n, ok := t.next[k]; ok && now.Before(n) {
+		return false
+	}
+	t.next[k] = now.Add(delay)
+	return true
+}
+
+// Wait returns how long until the bot and client IP may make another request.
+func (t *Tracker) Wait(bot string, ip string, now time.Time) time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	n, ok := t.next[[2]string{bot, ip}]
+	if !ok || !now.Before(n) {
+		return 0
+	}
+	return n.Sub(now)
+}
+
+// Expire removes each bot and client IP pair that may make another request, as they have nothing left to enforce.
+func (t *Tracker) Expire(now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for k, n := range t.next {
+		if !now.Before(n) {
+			delete(t.next, k)
+		}
+	}
+}
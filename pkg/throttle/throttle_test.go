@@ -0,0 +1,54 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTrackerAllow tests that requests from a bot and client IP are only allowed once the delay since their last allowed request has passed
+func TestTrackerAllow(t *testing.T) {
+	tr := New()
+	start := time.Now()
+	delay := 10 * time.Second
+
+	if !tr.Allow("GPTBot", "192.0.2.1", delay, start) {
+		t.Error("expected the first request from a bot and client IP to be allowed")
+	}
+	now := start.Add(4 * time.Second)
+	if tr.Allow("GPTBot", "192.0.2.1", delay, now) {
+		t.Error("expected a request within the delay not to be allowed")
+	}
+	if wait := tr.Wait("GPTBot", "192.0.2.1", now); wait != 6*time.Second {
+		t.Errorf("expected to wait 6s, got %s", wait)
+	}
+	// a request that wasn't allowed doesn't restart the delay
+	if !tr.Allow("GPTBot", "192.0.2.1", delay, start.Add(delay)) {
+		t.Error("expected a request after the delay to be allowed")
+	}
+	if !tr.Allow("GPTBot", "192.0.2.2", delay, start.Add(delay)) {
+		t.Error("expected a request from another client IP to be allowed")
+	}
+	if !tr.Allow("ClaudeBot", "192.0.2.1", delay, start.Add(delay)) {
+		t.Error("expected a request from another bot to be allowed")
+	}
+	if wait := tr.Wait("PerplexityBot", "192.0.2.1", start); wait != 0 {
+		t.Errorf("expected no wait for an untracked bot, got %s", wait)
+	}
+}
+
+// TestTrackerExpire tests that pairs are removed once they may make another request
+func TestTrackerExpire(t *testing.T) {
+	tr := New()
+	start := time.Now()
+	tr.Allow("GPTBot", "192.0.2.1", time.Second, start)
+	tr.Allow("ClaudeBot", "192.0.2.1", time.Minute, start)
+
+	tr.Expire(start.Add(time.Second))
+	if len(tr.next) != 1 {
+		t.Errorf("expected only the pair with a delay remaining to be kept, got %v", tr.next)
+	}
+	tr.Expire(start.Add(time.Minute))
+	if len(tr.next) != 0 {
+		t.Errorf("expected all pairs to be removed, %d remain", len(tr.next))
+	}
+}
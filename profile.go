@@ -0,0 +1,76 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"net"
+	"strings"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/botmanager"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/logger"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/parser"
+)
+
+// hostProfile is the robots.txt and bot action applied to requests for a set of hosts.
+type hostProfile struct {
+	hosts        []string
+	botAction    string
+	botUAManager *botmanager.BotUAManager
+}
+
+// newHostProfiles initializes a hostProfile for each configured profile, sharing sources through the provided pool.
+func newHostProfiles(c *config.Config, l *logger.Log, pool *parser.SourcePool) ([]*hostProfile, error) {
+	profiles := make([]*hostProfile, 0, len(c.Profiles))
+	for _, p := range c.Profiles {
+		pc := c.ProfileConfig(p)
+		uAMan, err := botmanager.NewWithPool(pc, l, pool)
+		if err != nil {
+			return nil, err
+		}
+		var hosts []string
+		for _, h := range strings.Split(p.Hosts, ",") {
+			hosts = append(hosts, strings.ToLower(strings.TrimSpace(h)))
+		}
+		profiles = append(profiles, &hostProfile{hosts: hosts, botAction: pc.BotAction, botUAManager: uAMan})
+	}
+	return profiles, nil
+}
+
+// matches checks if the profile applies to the provided host. A host pattern beginning with '*.' matches any subdomain.
+func (p *hostProfile) matches(host string) bool {
+	for _, h := range p.hosts {
+		if h == host {
+			return true
+		}
+		if strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostPolicy returns the bot action and BotUAManager that apply to the provided request host.
+// The first matching profile is used, otherwise the top level configuration applies.
+func (w *Wrangler) hostPolicy(host string) (string, *botmanager.BotUAManager) {
+	if len(w.profiles) == 0 {
+		return w.botAction, w.botUAManager
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, p := range w.profiles {
+		if p.matches(host) {
+			return p.botAction, p.botUAManager
+		}
+	}
+	return w.botAction, w.botUAManager
+}
+
+// botManagers returns the BotUAManager of the top level configuration, along with that of each profile.
+func (w *Wrangler) botManagers() []*botmanager.BotUAManager {
+	m := []*botmanager.BotUAManager{w.botUAManager}
+	for _, p := range w.profiles {
+		m = append(m, p.botUAManager)
+	}
+	return m
+}
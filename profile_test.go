@@ -0,0 +1,72 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+)
+
+// TestWranglerHostProfiles tests that each host gets the bot action and robots.txt of its profile, and that shared sources are only retrieved once
+func TestWranglerHostProfiles(t *testing.T) {
+	var lock sync.Mutex
+	requests := map[string]int{}
+	src := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests[r.URL.Path]++
+		lock.Unlock()
+		_, _ = fmt.Fprintf(w, "User-agent: %s\nDisallow: /\n", strings.TrimPrefix(r.URL.Path, "/"))
+	}))
+	defer src.Close()
+
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL + "/GPTBot"
+	cfg.Profiles = []config.Profile{
+		{Hosts: "shop.example.com", BotAction: config.BotActionBlock},
+		{Hosts: "*.example.org", RobotsSourceURL: src.URL + "/GPTBot," + src.URL + "/ClaudeBot", RobotsTXTSitemaps: "/sitemap.xml"},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, "upstream")
+	})
+	h, err := New(context.Background(), next, cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(url string, uA string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("User-Agent", uA)
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, req)
+		body, _ := io.ReadAll(recorder.Result().Body)
+		return recorder.Code, string(body)
+	}
+
+	if code, _ := serve("http://shop.example.com:8080/", "GPTBot"); code != cfg.BotBlockHTTPCode {
+		t.Errorf("expected the BLOCK profile to block bots on its host, got %d", code)
+	}
+	if code, body := serve("http://localhost/", "GPTBot"); code != http.StatusOK || body != "upstream" {
+		t.Errorf("expected the top level LOG action to pass bots on other hosts, got %d '%s'", code, body)
+	}
+	_, body := serve("http://www.example.org/robots.txt", "")
+	for _, want := range []string{"User-agent: ClaudeBot", "User-agent: GPTBot", "Sitemap: http://www.example.org/sitemap.xml"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the wildcard profile's robots.txt to contain '%s'. Got: %s", want, body)
+		}
+	}
+	if _, body = serve("http://localhost/robots.txt", ""); strings.Contains(body, "ClaudeBot") {
+		t.Errorf("expected hosts without a profile to get the top level robots.txt. Got: %s", body)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if requests["/GPTBot"] != 1 || requests["/ClaudeBot"] != 1 {
+		t.Errorf("expected each source to be retrieved once, regardless of how many profiles use it. Got %v", requests)
+	}
+}
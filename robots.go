@@ -0,0 +1,187 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/botmanager"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/parser"
+)
+
+// bufferedResponseWriter captures a response from the next handler, so it can be inspected instead of sent to the client.
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponseWriter() *bufferedResponseWriter {
+	return &bufferedResponseWriter{header: http.Header{}}
+}
+
+func (b *bufferedResponseWriter) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponseWriter) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponseWriter) WriteHeader(s int) {
+	if b.status == 0 {
+		b.status = s
+	}
+}
+
+// errorRecordingResponseWriter records the first error encountered writing a response, which http.ServeContent would otherwise discard.
+type errorRecordingResponseWriter struct {
+	http.ResponseWriter
+	err error
+}
+
+func (e *errorRecordingResponseWriter) Write(p []byte) (int, error) {
+	n, err := e.ResponseWriter.Write(p)
+	if err != nil && e.err == nil {
+		e.err = err
+	}
+	return n, err
+}
+
+// mergedRobotsEntry is a merged robots.txt, rendered for a single host.
+type mergedRobotsEntry struct {
+	body     []byte
+	expires  time.Time
+	modified time.Time
+}
+
+// mergedRobotsCache holds merged robots.txt files per host, since the upstream application may serve a different file for each.
+type mergedRobotsCache struct {
+	entries map[string]mergedRobotsEntry
+	limit   int
+	lock    sync.Mutex
+	ttl     time.Duration
+}
+
+func newMergedRobotsCache(ttl time.Duration, limit int) *mergedRobotsCache {
+	return &mergedRobotsCache{
+		entries: make(map[string]mergedRobotsEntry),
+		limit:   limit,
+		ttl:     ttl,
+	}
+}
+
+func (c *mergedRobotsCache) get(host string) (mergedRobotsEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	e, ok := c.entries[host]
+	if !ok || time.Now().After(e.expires) {
+		return mergedRobotsEntry{}, false
+	}
+	return e, true
+}
+
+func (c *mergedRobotsCache) set(host string, body []byte) mergedRobotsEntry {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	e := mergedRobotsEntry{body: body, expires: now.Add(c.ttl), modified: now}
+	// an expired entry being retrieved again with the same content hasn't been modified
+	if prev, ok := c.entries[host]; ok && bytes.Equal(prev.body, body) {
+		e.modified = prev.modified
+	}
+	// the Host header is client controlled, so don't let the cache grow without bound
+	if len(c.entries) >= c.limit {
+		c.entries = make(map[string]mergedRobotsEntry)
+	}
+	c.entries[host] = e
+	return e
+}
+
+// initRobotsTxt sets up caching of the served robots.txt, and merging it with the upstream application's if configured.
+func (w *Wrangler) initRobotsTxt(c *config.Config) {
+	// clients shouldn't hold onto the robots.txt longer than it takes us to refresh it
+	// we validated the time durations earlier, so ignore any error now
+	w.robotsMaxAge, _ = time.ParseDuration(c.CacheUpdateInterval)
+	if c.RobotsTXTMergeUpstream {
+		ttl, _ := time.ParseDuration(c.RobotsTXTMergeCacheTTL)
+		w.robotsMergeCache = newMergedRobotsCache(ttl, c.CacheSize)
+		if ttl < w.robotsMaxAge {
+			w.robotsMaxAge = ttl
+		}
+	}
+}
+
+// serveRobotsTxt writes our robots.txt into the response, merged with the upstream application's if configured.
+func (w *Wrangler) serveRobotsTxt(rw http.ResponseWriter, req *http.Request, uAMan *botmanager.BotUAManager) error {
+	var body []byte
+	var modified time.Time
+	if w.robotsMergeCache == nil {
+		buf := &bytes.Buffer{}
+		err := uAMan.RenderRobotsTxt(buf, req, true)
+		if err != nil {
+			return err
+		}
+		body = buf.Bytes()
+		modified = uAMan.LastModified()
+	} else {
+		e, hit := w.robotsMergeCache.get(req.Host)
+		if !hit {
+			merged, err := w.mergeRobotsTxt(req, uAMan)
+			if err != nil {
+				return err
+			}
+			e = w.robotsMergeCache.set(req.Host, []byte(merged.String()))
+		}
+		body = e.body
+		modified = e.modified
+	}
+
+	sum := sha256.Sum256(body)
+	rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	rw.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	rw.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(w.robotsMaxAge.Seconds())))
+	// handles conditional requests, and HEAD requests, for us
+	eRW := &errorRecordingResponseWriter{ResponseWriter: rw}
+	http.ServeContent(eRW, req, "robots.txt", modified, bytes.NewReader(body))
+	return eRW.err
+}
+
+// mergeRobotsTxt retrieves the upstream application's robots.txt through the next handler, and combines it with our generated robots.txt.
+// Our generated groups take precedence for any user-agent that both files have a group for.
+func (w *Wrangler) mergeRobotsTxt(req *http.Request, uAMan *botmanager.BotUAManager) (*parser.RobotsTxt, error) {
+	gen := &bytes.Buffer{}
+	err := uAMan.RenderRobotsTxt(gen, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// we need the full file, regardless of what the client asked for
+	upReq := req.Clone(req.Context())
+	upReq.Method = http.MethodGet
+	for _, h := range []string{"If-None-Match", "If-Modified-Since", "Range", "If-Range"} {
+		upReq.Header.Del(h)
+	}
+	upRes := newBufferedResponseWriter()
+	w.next.ServeHTTP(upRes, upReq)
+
+	merged := &parser.RobotsTxt{}
+	if upRes.status == http.StatusOK {
+		merged = parser.ParseRobotsTxt(&upRes.body)
+		for _, warn := range merged.Warnings {
+			w.log.Debug("mergeRobotsTxt: problem with upstream robots.txt", "line", warn.Line, "warning", warn.Message)
+		}
+	} else {
+		w.log.Debug("mergeRobotsTxt: upstream did not return a robots.txt, serving ours only", "status", upRes.status)
+	}
+	merged.Merge(parser.ParseRobotsTxt(gen))
+	return merged, nil
+}
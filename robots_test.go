@@ -0,0 +1,199 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/logger"
+)
+
+// getMergingWrangler is a helper function to initialize a Wrangler that merges robots.txt with the provided upstream handler
+func getMergingWrangler(t *testing.T, next http.Handler) *Wrangler {
+	t.Helper()
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL
+	cfg.RobotsTXTMergeUpstream = true
+
+	h, err := New(context.Background(), next, cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := h.(*Wrangler)
+	if !ok {
+		t.Fatal("unable to assert handler as type Wrangler")
+	}
+	w.log = logger.NewFromWriter(config.LogLevelDebug, &testLogOut)
+	return w
+}
+
+// TestWranglerRobotsTxtMerge tests that the upstream application's robots.txt rules and sitemaps are kept alongside our bot groups
+func TestWranglerRobotsTxtMerge(t *testing.T) {
+	upstreamCalls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		if r.URL.Path != "/robots.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprint(w, "User-agent: *\nDisallow: /admin/\n\nUser-agent: GPTBot\nAllow: /\n\nSitemap: https://example.com/sitemap.xml\n")
+	})
+	w := getMergingWrangler(t, next)
+
+	res := getWranglerResponse(t, w, "http://localhost/robots.txt", "")
+	resBodyB, _ := io.ReadAll(res.Body)
+	resBody := string(resBodyB)
+	for _, want := range []string{"User-agent: *\nDisallow: /admin/\n", "User-agent: GPTBot\nDisallow: /\n", "Sitemap: https://example.com/sitemap.xml\n"} {
+		if !strings.Contains(resBody, want) {
+			t.Errorf("merged robots.txt did not contain '%s'. Got: %s", want, resBody)
+		}
+	}
+	if strings.Contains(resBody, "Allow: /\n") {
+		t.Errorf("merged robots.txt kept the upstream group for a bot on our list. Got: %s", resBody)
+	}
+
+	// a second request should be served from cache
+	_ = getWranglerResponse(t, w, "http://localhost/robots.txt", "")
+	if upstreamCalls != 1 {
+		t.Errorf("expected upstream robots.txt to be fetched once while cached, got %d requests", upstreamCalls)
+	}
+}
+
+// TestWranglerRobotsTxtMergeMaze tests that the upstream application's wildcard rules are combined with the reserved maze path, rather than replaced by it
+func TestWranglerRobotsTxtMergeMaze(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, "User-agent: *\nDisallow: /admin/\n")
+	})
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL
+	cfg.RobotsTXTMergeUpstream = true
+	cfg.BotAction = config.BotActionMaze
+	cfg.BotMazePathPrefix = "/maze/"
+	h, err := New(context.Background(), next, cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost/robots.txt", nil))
+	resBody := recorder.Body.String()
+	if !strings.Contains(resBody, "User-agent: *\nDisallow: /admin/\nDisallow: /maze/\n") {
+		t.Errorf("expected the upstream wildcard rules to be kept alongside the maze path. Got: %s", resBody)
+	}
+	if strings.Count(resBody, "User-agent: *") != 1 {
+		t.Errorf("expected a single wildcard group. Got: %s", resBody)
+	}
+}
+
+// TestWranglerRobotsTxtMergeDisallowAll tests that the upstream application's wildcard allow rules can't override robotsTxtDisallowAll
+func TestWranglerRobotsTxtMergeDisallowAll(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, "User-agent: *\nDisallow: /admin/\nAllow: /blog/\n")
+	})
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL
+	cfg.RobotsTXTMergeUpstream = true
+	cfg.RobotsTXTDisallowAll = true
+	h, err := New(context.Background(), next, cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://localhost/robots.txt", nil))
+	resBody := recorder.Body.String()
+	if strings.Contains(resBody, "Allow: /blog/") || !strings.Contains(resBody, "Disallow: /\n") {
+		t.Errorf("expected the upstream wildcard allow rule to be dropped in favor of disallowing all. Got: %s", resBody)
+	}
+}
+
+// TestWranglerRobotsTxtMergeNoUpstream tests that our robots.txt is still served when the upstream application has none
+func TestWranglerRobotsTxtMergeNoUpstream(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, "not found")
+	})
+	w := getMergingWrangler(t, next)
+
+	res := getWranglerResponse(t, w, "http://localhost/robots.txt", "")
+	resBodyB, _ := io.ReadAll(res.Body)
+	resBody := string(resBodyB)
+	if res.StatusCode != http.StatusOK || resBody != "User-agent: GPTBot\nDisallow: /\n" {
+		t.Errorf("expected only our robots.txt to be served when upstream has none. Got %d: %s", res.StatusCode, resBody)
+	}
+}
+
+// TestWranglerRobotsTxtCaching tests that the robots.txt is served with caching headers, and conditional and HEAD requests are answered appropriately
+func TestWranglerRobotsTxtCaching(t *testing.T) {
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL
+	h, err := New(context.Background(), http.NotFoundHandler(), cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method string, header map[string]string) *http.Response {
+		req := httptest.NewRequest(method, "http://localhost/robots.txt", nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, req)
+		return recorder.Result()
+	}
+
+	res := serve(http.MethodGet, nil)
+	body, _ := io.ReadAll(res.Body)
+	etag := res.Header.Get("ETag")
+	lastModified := res.Header.Get("Last-Modified")
+	if ct := res.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("expected robots.txt Content-Type 'text/plain; charset=utf-8', got '%s'", ct)
+	}
+	if etag == "" || lastModified == "" || res.Header.Get("Cache-Control") != "public, max-age=86400" {
+		t.Errorf("expected ETag, Last-Modified, and Cache-Control headers to be set, got %v", res.Header)
+	}
+
+	// the same content must always produce the same ETag
+	res = serve(http.MethodGet, nil)
+	again, _ := io.ReadAll(res.Body)
+	if string(again) != string(body) || res.Header.Get("ETag") != etag {
+		t.Error("expected repeated robots.txt requests to be rendered identically")
+	}
+
+	res = serve(http.MethodGet, map[string]string{"If-None-Match": etag})
+	if res.StatusCode != http.StatusNotModified {
+		t.Errorf("expected If-None-Match with the current ETag to return 304, got %d", res.StatusCode)
+	}
+	res = serve(http.MethodGet, map[string]string{"If-Modified-Since": lastModified})
+	if res.StatusCode != http.StatusNotModified {
+		t.Errorf("expected If-Modified-Since with the Last-Modified time to return 304, got %d", res.StatusCode)
+	}
+
+	res = serve(http.MethodHead, nil)
+	headBody, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || len(headBody) != 0 || res.Header.Get("ETag") != etag {
+		t.Errorf("expected HEAD request to return headers only, got %d with body '%s'", res.StatusCode, headBody)
+	}
+}
+
+// TestWranglerRobotsTxtWriteError tests that an error writing the robots.txt response is logged
+func TestWranglerRobotsTxtWriteError(t *testing.T) {
+	testLogOut.Reset()
+	w := getMergingWrangler(t, http.NotFoundHandler())
+	w.log = logger.NewFromWriter(config.LogLevelError, &testLogOut)
+
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/robots.txt", nil)
+	w.ServeHTTP(&badResponseWriter{ResponseWriter: httptest.NewRecorder()}, req)
+	if !strings.Contains(testLogOut.String(), "ServeHTTP: Error rendering robots.txt template. write failed") {
+		t.Errorf("failing to write the robots.txt response did not log the expected error. Got: %s", testLogOut.String())
+	}
+}
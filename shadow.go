@@ -0,0 +1,44 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"net/http"
+	"sync"
+)
+
+// decisionCounter keeps a running count of the decisions made for bot requests, keyed by the action that would be taken.
+type decisionCounter struct {
+	counts map[string]int
+	lock   sync.Mutex
+}
+
+func newDecisionCounter() *decisionCounter {
+	return &decisionCounter{counts: make(map[string]int)}
+}
+
+// add records a decision, returning the count of that decision so far.
+func (d *decisionCounter) add(action string) int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.counts[action]++
+	return d.counts[action]
+}
+
+// snapshot returns a copy of the current decision counts.
+func (d *decisionCounter) snapshot() map[string]int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	s := make(map[string]int, len(d.counts))
+	for k, v := range d.counts {
+		s[k] = v
+	}
+	return s
+}
+
+// logShadowDecision records and logs the action that would have been applied to a request, had shadow mode been disabled.
+func (w *Wrangler) logShadowDecision(req *http.Request, wouldAction string, liveAction string, rule string, source string) {
+	count := w.decisions.add(wouldAction)
+	w.log.Info("ServeHTTP: Shadow mode decision", "userAgent", req.Header.Get("User-Agent"), "sourceIP", req.RemoteAddr,
+		"requestedPath", req.URL.Path, "wouldAction", wouldAction, "liveAction", liveAction, "rule", rule, "source", source,
+		"decisionCount", count,
+	)
+}
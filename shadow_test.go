@@ -0,0 +1,54 @@
+package bot_wrangler_traefik_plugin //nolint:revive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/logger"
+)
+
+// TestWranglerShadowMode tests that in shadow mode the configured action is logged and counted, while the live action is applied
+func TestWranglerShadowMode(t *testing.T) {
+	testLogOut.Reset()
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.BotAction = config.BotActionBlock
+	cfg.RobotsSourceURL = src.URL
+	cfg.ShadowMode = true
+	cfg.ShadowLiveAction = "log"
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, "upstream")
+	})
+	h, err := New(context.Background(), next, cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := h.(*Wrangler)
+	if !ok {
+		t.Fatal("unable to assert handler as type Wrangler")
+	}
+	w.log = logger.NewFromWriter(config.LogLevelInfo, &testLogOut)
+
+	for i := 0; i < 2; i++ { //nolint:intrange,modernize
+		res := getWranglerResponse(t, w, "http://localhost/", BotUserAgent)
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("expected the live LOG action to pass the bot in shadow mode, got %d", res.StatusCode)
+		}
+	}
+	_ = getWranglerResponse(t, w, "http://localhost/", RealUserAgent)
+
+	got := testLogOut.String()
+	for _, want := range []string{"wouldAction=BLOCK", "liveAction=LOG", "rule=GPTBot", "source=" + src.URL, "decisionCount=2", "remediationAction=LOG"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected shadow mode log to contain '%s'. Got: %s", want, got)
+		}
+	}
+	counts := w.decisions.snapshot()
+	if len(counts) != 1 || counts[config.BotActionBlock] != 2 {
+		t.Errorf("expected 2 BLOCK decisions to be counted, got %v", counts)
+	}
+}
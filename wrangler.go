@@ -5,29 +5,56 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/audit"
 	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/botmanager"
 	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
 	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/logger"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/maze"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/notify"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/parser"
 	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/proxy"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/scope"
+	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/throttle"
 )
 
+const bytesPerMegabyte = 1024 * 1024
+
 // Wrangler used to manage a instance of the plugin.
 type Wrangler struct {
 	next http.Handler
 	name string
 
 	enabled              bool
+	adminAllowIPs        []*net.IPNet
+	adminPath            string
+	adminToken           string
+	audit                *audit.Logger
 	botAction            string
 	botBlockHTTPCode     int
 	botBlockHTTPResponse string
 	botUAManager         *botmanager.BotUAManager
+	crawlDelays          *throttle.Tracker
+	decisions            *decisionCounter
+	detector             *notify.Detector
 	log                  *logger.Log
+	logLimiter           *logger.Limiter
+	maze                 *maze.Maze
+	notifier             *notify.Notifier
+	profiles             []*hostProfile
+	scope                *scope.Scope
 	proxy                *proxy.BotProxy
+	robotsMaxAge         time.Duration
+	robotsMergeCache     *mergedRobotsCache
 	setNoArchiveHeader   bool
+	shadowLiveAction     string
+	shadowMode           bool
 }
 
 // CreateConfig creates the default plugin configuration.
@@ -36,28 +63,46 @@ func CreateConfig() *config.Config {
 }
 
 // New creates a new plugin instance.
-func New(_ context.Context, next http.Handler, c *config.Config, name string) (http.Handler, error) {
+func New(ctx context.Context, next http.Handler, c *config.Config, name string) (http.Handler, error) {
 	log := logger.New(c.LogLevel)
 	c.BotAction = strings.ToUpper(c.BotAction)
+	c.ShadowLiveAction = strings.ToUpper(c.ShadowLiveAction)
+	c.BotProxyBalancer = strings.ToUpper(c.BotProxyBalancer)
 
 	err := c.ValidateConfig()
 	if err != nil {
 		log.Error("New: unable to load configuration properly. " + err.Error())
 		return nil, err
 	}
+	logOut, err := logger.OpenDestination(c.LogDestination, int64(c.LogMaxSize)*bytesPerMegabyte, c.LogMaxBackups)
+	if err != nil {
+		log.Error("New: unable to open log destination. " + err.Error())
+		return nil, err
+	}
+	if f, ok := logOut.(*logger.RotatingFile); ok {
+		go closeOnDone(ctx, f, log)
+	}
+	log = logger.NewWithFormat(c.LogLevel, c.LogFormat, logOut)
 
-	uAMan, err := botmanager.New(c.RobotsSourceURL, c.CacheUpdateInterval, log, c.CacheSize, c.UseFastMatch, c.RobotsTXTDisallowAll, c.RobotsTXTFilePath, c.RobotsSourceRetryInterval)
+	// sources used by more than one profile are only retrieved once per update
+	pool := parser.NewSourcePool()
+	uAMan, err := botmanager.NewWithPool(c, log, pool)
 	if err != nil {
 		log.Error("New: Unable to initialize bot user agent list manager. " + err.Error())
 		return nil, err
 	}
-	var bP *proxy.BotProxy
-	if c.BotProxyURL != "" {
-		bP = proxy.New(c.BotProxyURL)
+	profiles, err := newHostProfiles(c, log, pool)
+	if err != nil {
+		log.Error("New: Unable to initialize bot user agent list manager for host profile. " + err.Error())
+		return nil, err
+	}
+	var m *maze.Maze
+	if c.UsesAction(config.BotActionMaze) {
+		m = maze.New(c.BotMazePathPrefix, c.BotMazeLinkCount)
 	}
 
 	enable, _ := strconv.ParseBool(c.Enabled)
-	return &Wrangler{
+	w := &Wrangler{
 		next: next,
 		name: name,
 
@@ -67,12 +112,38 @@ func New(_ context.Context, next http.Handler, c *config.Config, name string) (h
 		botBlockHTTPCode:     c.BotBlockHTTPCode,
 		botBlockHTTPResponse: c.BotBlockHTTPResponse,
 		log:                  log,
+		maze:                 m,
+		profiles:             profiles,
+		scope:                scope.New(c),
 		setNoArchiveHeader:   c.SetNoArchiveHeader,
-		proxy:                bP,
-	}, nil
+		shadowLiveAction:     c.ShadowLiveAction,
+		shadowMode:           c.ShadowMode,
+	}
+	err = w.initLogging(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	w.initNotify(ctx, c)
+	w.initCrawlDelay(ctx, c)
+	w.initRobotsTxt(c)
+	w.initAdmin(c)
+	if c.ShadowMode {
+		w.decisions = newDecisionCounter()
+		log.Info("New: shadow mode enabled, bot actions will be logged but '" + c.ShadowLiveAction + "' will be applied")
+	}
+	if c.BotProxyURL != "" {
+		// if the bot can't be proxied anywhere, block it rather than returning an error page
+		w.proxy = proxy.New(ctx, c, log, http.HandlerFunc(w.handleOutcomeBlock))
+	}
+	return w, nil
 }
 
 func (w *Wrangler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	// admin endpoints remain available while the plugin is disabled
+	if w.isAdminRequest(req) {
+		w.serveAdmin(rw, req)
+		return
+	}
 	// make sure we should process the request.
 	if !w.enabled {
 		w.log.Debug("ServeHTTP: Plugin is not enabled.")
@@ -81,53 +152,111 @@ func (w *Wrangler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	uA := req.Header.Get("User-Agent")
+	botAction, wouldAction, uAMan, inScope := w.requestAction(req)
 	// if they are checking robots.txt, give them our list
 	rPath := req.URL.Path
 	if rPath == "/robots.txt" {
 		w.log.Debug("ServeHTTP: /robots.txt requested, rendering with active block list", "userAgent", uA)
-		err := w.botUAManager.RenderRobotsTxt(rw, true)
+		err := w.serveRobotsTxt(rw, req, uAMan)
 		if err != nil {
 			w.log.Error("ServeHTTP: Error rendering robots.txt template. " + err.Error())
 		}
 		return
 	}
 
+	if !inScope {
+		w.log.Debug("ServeHTTP: Request is out of scope, passing traffic", "requestedPath", rPath, "method", req.Method)
+		w.next.ServeHTTP(rw, req)
+		return
+	}
+
 	// if its a normal request, see if they're on the bad robots list
 	w.log.Debug("ServeHTTP: Got a request to evaluate", "userAgent", uA)
-	botName, botInfo, err := w.botUAManager.Search(uA)
+	botName, botInfo, err := uAMan.Search(uA)
 	if err != nil {
 		w.log.Error("ServeHTTP: Unable to search cache. " + err.Error())
 		w.next.ServeHTTP(rw, req)
 		return
 	}
 	if botName == "" {
-		w.log.Debug("ServeHTTP: User agent did not match block list, passing traffic", "userAgent", uA)
-		w.next.ServeHTTP(rw, req)
+		w.handleUnlisted(rw, req, wouldAction, botAction)
 		return
 	}
 	w.log.Debug("ServeHTTP: Found bot name match of '"+botName+"'", "userAgent", uA)
+	botAction, wouldAction = w.applyCrawlDelay(req, botAction, wouldAction, botName, botInfo)
+	if w.shadowMode {
+		w.logShadowDecision(req, wouldAction, botAction, botName, botInfo.Source)
+	}
+	w.handleBot(rw, req, botAction, botName, botInfo)
+}
+
+// requestAction resolves the bot action to apply to the request, from its host profile and scope.
+// In shadow mode, the live action is returned, along with the configured action that would be taken. Returns false if the request is out of scope.
+func (w *Wrangler) requestAction(req *http.Request) (string, string, *botmanager.BotUAManager, bool) {
+	botAction, uAMan := w.hostPolicy(req.Host)
+	// some routes should never be remediated, while others may want a different action
+	botAction, inScope := w.scope.Action(req.URL.Path, req.Method, botAction)
+	// in shadow mode, the configured action is only logged, while the live action is applied
+	wouldAction := botAction
+	if w.shadowMode && inScope {
+		botAction = w.shadowLiveAction
+	}
+	return botAction, wouldAction, uAMan, inScope
+}
 
-	if w.botAction != config.BotActionPass {
+// handleUnlisted processes requests from user agents that are not on the bot list.
+func (w *Wrangler) handleUnlisted(rw http.ResponseWriter, req *http.Request, wouldAction string, botAction string) {
+	uA := req.Header.Get("User-Agent")
+	rPath := req.URL.Path
+	// only crawlers that ignored the Disallow in our robots.txt should ever end up in the maze
+	if wouldAction == config.BotActionMaze && w.maze.Contains(rPath) {
+		if w.shadowMode {
+			w.logShadowDecision(req, wouldAction, botAction, "botMazePathPrefix", "")
+		}
+		if botAction == config.BotActionMaze {
+			w.log.Info("ServeHTTP: Unlisted user agent wandered into the bot maze, rendering maze page", "userAgent", uA, "sourceIP", req.RemoteAddr, "requestedPath", rPath)
+			w.auditResponse(rw, req, "", "", botAction, func(rw http.ResponseWriter) {
+				w.maze.ServeHTTP(rw, req)
+			})
+			return
+		}
+	}
+	w.log.Debug("ServeHTTP: User agent did not match block list, passing traffic", "userAgent", uA)
+	w.next.ServeHTTP(rw, req)
+}
+
+// handleBot logs a request from a bot on the list, and applies the provided BotAction to it.
+func (w *Wrangler) handleBot(rw http.ResponseWriter, req *http.Request, botAction string, botName string, botInfo parser.BotUserAgent) {
+	if botAction != config.BotActionPass && w.allowBotLog(botName, req) {
+		uA := req.Header.Get("User-Agent")
 		uALogMsg := fmt.Sprintf("ServeHTTP: User agent '%s' considered AI Robot.", uA)
 		uAMetadata := botInfo.JSONMetadata
 		w.log.Info(uALogMsg, "userAgent", uA, "sourceIP", req.RemoteAddr, "requestedPath",
-			rPath, "remediationAction", w.botAction, "operator", uAMetadata.Operator, "respectsRobotsTxt",
+			req.URL.Path, "remediationAction", botAction, "operator", uAMetadata.Operator, "respectsRobotsTxt",
 			uAMetadata.Respect, "function", uAMetadata.Function, "description", uAMetadata.Description,
 		)
 	}
 
+	w.notifyDetection(req, botName)
+
 	// if specified, set the X-Robots-Tag header
 	if w.setNoArchiveHeader {
 		rw.Header().Add("X-Robots-Tag", "noarchive")
 	}
 
 	// handle outcome of the request for the bot.
-	w.handleOutcome(rw, req)
+	if botAction == config.BotActionPass {
+		w.handleOutcome(rw, req, botAction, botName, botInfo)
+		return
+	}
+	w.auditResponse(rw, req, botName, botInfo.Source, botAction, func(rw http.ResponseWriter) {
+		w.handleOutcome(rw, req, botAction, botName, botInfo)
+	})
 }
 
-// handleOutcome applies the appropriate remediation actions to the request based on the config's BotAction.
-func (w *Wrangler) handleOutcome(rw http.ResponseWriter, req *http.Request) {
-	switch w.botAction {
+// handleOutcome applies the appropriate remediation actions to the request based on the provided BotAction.
+func (w *Wrangler) handleOutcome(rw http.ResponseWriter, req *http.Request, botAction string, botName string, botInfo parser.BotUserAgent) {
+	switch botAction {
 	case config.BotActionLog:
 		fallthrough
 	case config.BotActionPass:
@@ -135,7 +264,11 @@ func (w *Wrangler) handleOutcome(rw http.ResponseWriter, req *http.Request) {
 	case config.BotActionBlock:
 		w.handleOutcomeBlock(rw, req)
 	case config.BotActionProxy:
-		w.handleOutcomeProxy(rw, req)
+		w.handleOutcomeProxy(rw, req, botName, botInfo.JSONMetadata.Operator)
+	case config.BotActionMaze:
+		w.handleOutcomeMaze(rw, req)
+	case botActionThrottle:
+		w.handleOutcomeThrottle(rw, req, botName)
 	}
 }
 
@@ -163,13 +296,81 @@ func (w *Wrangler) handleOutcomeBlock(rw http.ResponseWriter, _ *http.Request) {
 }
 
 // handleOutcomeProxy processes tasks if the bot request should be proxied.
-func (w *Wrangler) handleOutcomeProxy(rw http.ResponseWriter, req *http.Request) {
+func (w *Wrangler) handleOutcomeProxy(rw http.ResponseWriter, req *http.Request, botName string, operator string) {
 	w.log.Debug("ServeHTTP: Starting proxying request from bot")
 	if w.proxy == nil {
 		w.log.Error("ServeHTTP: cannot proxy request, proxy failed to initialize during setup. Falling back to BLOCK")
 		w.handleOutcomeBlock(rw, req)
 		return
 	}
-	w.proxy.ServeHTTP(rw, req)
+	w.proxy.ServeBot(rw, req, botName, operator)
 	w.log.Debug("ServeHTTP: finished proxying request")
 }
+
+// handleOutcomeMaze processes tasks if the bot request should be sent into the link maze.
+func (w *Wrangler) handleOutcomeMaze(rw http.ResponseWriter, req *http.Request) {
+	w.log.Debug("ServeHTTP: Rendering maze page for bot")
+	w.maze.ServeHTTP(rw, req)
+}
+
+// closeOnDone closes the file once the context is canceled, which Traefik does when a configuration reload replaces the middleware.
+// Errors are reported to the provided logger, which must not write to the file.
+func closeOnDone(ctx context.Context, f io.Closer, log *logger.Log) {
+	<-ctx.Done()
+	err := f.Close()
+	if err != nil {
+		log.Error("closeOnDone: unable to close file. " + err.Error())
+	}
+}
+
+// initLogging sets up the audit log and suppression of repeated log lines, if configured.
+func (w *Wrangler) initLogging(ctx context.Context, c *config.Config) error {
+	if c.AuditLogPath != "" {
+		auditOut, err := logger.NewRotatingFile(c.AuditLogPath, int64(c.LogMaxSize)*bytesPerMegabyte, c.LogMaxBackups)
+		if err != nil {
+			w.log.Error("New: unable to open audit log. " + err.Error())
+			return err
+		}
+		go closeOnDone(ctx, auditOut, w.log)
+		w.audit = audit.New(auditOut, c.AuditLogFormat)
+	}
+	// we validated the time duration earlier, so ignore any error now
+	if dedup, _ := time.ParseDuration(c.LogDedupWindow); dedup > 0 {
+		w.logLimiter = logger.NewLimiter(dedup)
+		go w.expireLogLimiter(ctx, dedup)
+	}
+	return nil
+}
+
+// allowBotLog checks if a request from the bot should be logged, or suppressed as a repeat of a recent request from the same bot and client.
+func (w *Wrangler) allowBotLog(botName string, req *http.Request) bool {
+	if w.logLimiter == nil {
+		return true
+	}
+	allow, s := w.logLimiter.Allow(botName, clientIP(req), time.Now())
+	if s != nil {
+		w.logSuppressed(*s)
+	}
+	return allow
+}
+
+// expireLogLimiter periodically logs a summary of the lines suppressed by the log limiter, until the context is canceled.
+func (w *Wrangler) expireLogLimiter(ctx context.Context, window time.Duration) {
+	t := time.NewTicker(window)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			for _, s := range w.logLimiter.Expire(now) {
+				w.logSuppressed(s)
+			}
+		}
+	}
+}
+
+func (w *Wrangler) logSuppressed(s logger.Suppressed) {
+	w.log.Info(fmt.Sprintf("ServeHTTP: suppressed %d further hits from %s at %s in %s", s.Count, s.Bot, s.IP, s.Window),
+		"botName", s.Bot, "sourceIP", s.IP, "suppressedCount", s.Count)
+}
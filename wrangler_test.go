@@ -10,8 +10,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/config"
 	"github.com/holysoles/bot-wrangler-traefik-plugin/pkg/logger"
@@ -81,6 +83,26 @@ func TestWranglerInitBadBotProxyURL(t *testing.T) {
 	}
 }
 
+// TestWranglerInitBalancerCase tests that the bot proxy balancer is accepted regardless of case, like the bot action
+func TestWranglerInitBalancerCase(t *testing.T) {
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL
+	cfg.BotProxyBalancer = "roundRobin"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	next := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+
+	_, err := New(ctx, next, cfg, "wrangler")
+	if err != nil {
+		t.Errorf("New() returned an error for a lowercase bot proxy balancer: %s", err)
+	}
+	if cfg.BotProxyBalancer != "ROUNDROBIN" {
+		t.Errorf("expected the balancer to be normalized to ROUNDROBIN, got '%s'", cfg.BotProxyBalancer)
+	}
+}
+
 // badResponseWriter acts as a mock to force writing response content to fail
 type badResponseWriter struct {
 	http.ResponseWriter
@@ -566,3 +588,182 @@ func TestWranglerNoArchive(t *testing.T) {
 		})
 	}
 }
+
+// newTestSourceServer is a helper function to serve a small robots.json bot source locally
+func newTestSourceServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, err := fmt.Fprint(w, `{"GPTBot": {"operator": "OpenAI", "respect": "Yes", "function": "Scrapes data to train OpenAI's products.", "frequency": "No information.", "description": "Data is used to train current and future models."}}`)
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// TestWranglerMazeAction tests that bots are sent into the link maze, and that unlisted visitors inside the maze keep getting maze pages
+func TestWranglerMazeAction(t *testing.T) {
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.BotAction = config.BotActionMaze
+	cfg.RobotsSourceURL = src.URL
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, "upstream")
+	})
+
+	h, err := New(context.Background(), next, cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := h.(*Wrangler)
+	if !ok {
+		t.Fatal("unable to assert handler as type Wrangler")
+	}
+	w.log = logger.NewFromWriter(config.LogLevelInfo, &testLogOut)
+
+	type scenario struct {
+		url      string
+		ua       string
+		wantMaze bool
+	}
+	scenarios := []scenario{
+		{url: "http://localhost/", ua: BotUserAgent, wantMaze: true},
+		{url: "http://localhost/", ua: RealUserAgent, wantMaze: false},
+		{url: "http://localhost/maze/abcdef", ua: RealUserAgent, wantMaze: true},
+	}
+	for _, s := range scenarios {
+		t.Run(s.url+","+s.ua, func(t *testing.T) {
+			res := getWranglerResponse(t, w, s.url, s.ua)
+			resBody, _ := io.ReadAll(res.Body)
+			gotMaze := strings.Contains(string(resBody), `href="/maze/`)
+			if gotMaze != s.wantMaze {
+				t.Errorf("expected maze page to be served: %v, got: %v. Body: %s", s.wantMaze, gotMaze, resBody)
+			}
+		})
+	}
+
+	res := getWranglerResponse(t, w, "http://localhost/robots.txt", "")
+	resBody, _ := io.ReadAll(res.Body)
+	if !strings.Contains(string(resBody), "Disallow: /maze/") {
+		t.Errorf("robots.txt did not disallow the maze prefix. Got: %s", resBody)
+	}
+}
+
+// TestWranglerProxyActionFallback tests that the plugin yields blocked responses instead of an error page when no proxy backend can take the request
+func TestWranglerProxyActionFallback(t *testing.T) {
+	src := newTestSourceServer(t)
+	dead := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+	dead.Close()
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL
+	cfg.BotProxyURL = dead.URL
+	cfg.BotAction = config.BotActionProxy
+
+	next := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {})
+	h, err := New(context.Background(), next, cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := h.(*Wrangler)
+	if !ok {
+		t.Fatal("unable to assert handler as type Wrangler")
+	}
+	w.log = logger.NewFromWriter(config.LogLevelDebug, &testLogOut)
+
+	res := getWranglerResponse(t, w, "http://localhost/", BotUserAgent)
+	if res.StatusCode != cfg.BotBlockHTTPCode {
+		t.Errorf("expected request to a dead proxy backend to fall back to a block response with status %d, got %d", cfg.BotBlockHTTPCode, res.StatusCode)
+	}
+}
+
+// TestWranglerScopes tests that excluded paths are never remediated, and scoped paths use their own action
+func TestWranglerScopes(t *testing.T) {
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.BotAction = config.BotActionBlock
+	cfg.RobotsSourceURL = src.URL
+	cfg.ExcludePaths = "/healthz"
+	cfg.Scopes = []config.Scope{{Paths: "/public/**", BotAction: config.BotActionPass}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprint(w, "upstream")
+	})
+	h, err := New(context.Background(), next, cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := h.(*Wrangler)
+	if !ok {
+		t.Fatal("unable to assert handler as type Wrangler")
+	}
+
+	for path, wantCode := range map[string]int{
+		"/healthz":        http.StatusOK,
+		"/public/feed":    http.StatusOK,
+		"/private/things": cfg.BotBlockHTTPCode,
+	} {
+		res := getWranglerResponse(t, w, "http://localhost"+path, "GPTBot")
+		if res.StatusCode != wantCode {
+			t.Errorf("expected status %d for bot request to '%s', got %d", wantCode, path, res.StatusCode)
+		}
+	}
+}
+
+// TestWranglerLogDedup tests that repeated hits from the same bot and client are logged once, then summarized
+func TestWranglerLogDedup(t *testing.T) {
+	testLogOut.Reset()
+	src := newTestSourceServer(t)
+	cfg := CreateConfig()
+	cfg.RobotsSourceURL = src.URL
+	cfg.LogDedupWindow = "1h"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := New(ctx, http.NotFoundHandler(), cfg, "wrangler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, ok := h.(*Wrangler)
+	if !ok {
+		t.Fatal("unable to assert handler as type Wrangler")
+	}
+	w.log = logger.NewFromWriter(config.LogLevelInfo, &testLogOut)
+
+	for i := 0; i < 5; i++ { //nolint:intrange,modernize
+		_ = getWranglerResponse(t, w, "http://localhost/", BotUserAgent)
+	}
+	if n := strings.Count(testLogOut.String(), "considered AI Robot"); n != 1 {
+		t.Errorf("expected repeated bot hits to be logged once, got %d lines", n)
+	}
+	for _, s := range w.logLimiter.Expire(time.Now().Add(2 * time.Hour)) {
+		w.logSuppressed(s)
+	}
+	want := "suppressed 4 further hits from GPTBot"
+	if !strings.Contains(testLogOut.String(), want) {
+		t.Errorf("expected a summary of the suppressed hits. Wanted '%s', Got: %s", want, testLogOut.String())
+	}
+}
+
+// TestCloseOnDone tests that a log file is closed once the plugin's context is canceled, so reloads don't leak it
+func TestCloseOnDone(t *testing.T) {
+	f, err := logger.NewRotatingFile(t.TempDir()+"/wrangler.log", 1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		closeOnDone(ctx, f, logger.NewFromWriter(config.LogLevelInfo, io.Discard))
+		close(done)
+	}()
+	_, err = f.Write([]byte("open\n"))
+	if err != nil {
+		t.Fatalf("expected the file to be open until the context is canceled, got %s", err)
+	}
+	cancel()
+	<-done
+	_, err = f.Write([]byte("closed\n"))
+	if err == nil {
+		t.Error("expected the file to be closed once the context was canceled")
+	}
+}